@@ -0,0 +1,162 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/DamienFontaine/lunarc/config"
+	"gopkg.in/yaml.v2"
+
+	//Register the sections of the lunarc packages
+	_ "github.com/DamienFontaine/lunarc/datasource/mongo"
+	_ "github.com/DamienFontaine/lunarc/smtp"
+	_ "github.com/DamienFontaine/lunarc/web"
+)
+
+//printConfig prints the effective configuration of an environment, secrets masked,
+//or the differences between two environments.
+func printConfig(args []string, in io.Reader, out io.Writer) error {
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	format := flags.String("format", "yaml", "yaml or json")
+	diff := flags.String("diff", "", "environment to compare with")
+	show := flags.Bool("show-secrets", false, "print the secrets in clear")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	//The errors are returned, the logs of the loader would repeat them
+	log.SetOutput(ioutil.Discard)
+	if flags.NArg() != 2 {
+		return errors.New("expected a configuration file and an environment")
+	}
+	filename, environment := flags.Arg(0), flags.Arg(1)
+
+	tree, secrets, invalid := effective(filename, environment)
+	if tree == nil {
+		return invalid
+	}
+	if len(*diff) > 0 {
+		other, otherSecrets, otherInvalid := effective(filename, *diff)
+		if other == nil {
+			return otherInvalid
+		}
+		for key := range otherSecrets {
+			secrets[key] = true
+		}
+		if err := printDiff(out, environment, tree, *diff, other, secrets, *show); err != nil {
+			return err
+		}
+		if invalid == nil {
+			invalid = otherInvalid
+		}
+		return invalid
+	}
+
+	if !*show {
+		tree = config.Redact(tree, secrets)
+	}
+	switch *format {
+	case "yaml":
+		data, err := yaml.Marshal(tree)
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(out, "# environment %s\n", environment); err != nil {
+			return err
+		}
+		if _, err = out.Write(data); err != nil {
+			return err
+		}
+	case "json":
+		data, err := json.MarshalIndent(tree, "", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(out, "%s\n", data); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown format %s", *format)
+	}
+	return invalid
+}
+
+//effective loads environment from filename and its layers. The tree is nil when
+//the environment can't be loaded, and given with the errors when it is invalid.
+func effective(filename string, environment string) (map[string]interface{}, map[string]bool, error) {
+	loader, err := config.NewLoader(filename, environment)
+	if err != nil {
+		return nil, nil, err
+	}
+	return loader.Effective()
+}
+
+//printDiff prints the keys whose value differs between two environments
+func printDiff(out io.Writer, name string, tree map[string]interface{}, otherName string, other map[string]interface{}, secrets map[string]bool, show bool) error {
+	leaves, otherLeaves := config.Flatten(tree), config.Flatten(other)
+	keys := make(map[string]bool)
+	for key := range leaves {
+		keys[key] = true
+	}
+	for key := range otherLeaves {
+		keys[key] = true
+	}
+	var sorted []string
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	var lines []string
+	for _, key := range sorted {
+		value, ok := leaves[key]
+		otherValue, otherOk := otherLeaves[key]
+		if ok == otherOk && fmt.Sprint(value) == fmt.Sprint(otherValue) {
+			continue
+		}
+		if ok {
+			lines = append(lines, "-"+leaf(key, value, secrets, show))
+		}
+		if otherOk {
+			lines = append(lines, "+"+leaf(key, otherValue, secrets, show))
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(out, "--- %s\n+++ %s\n%s\n", name, otherName, strings.Join(lines, "\n"))
+	return err
+}
+
+func leaf(key string, value interface{}, secrets map[string]bool, show bool) string {
+	if !show && secrets[key] && value != nil && value != "" {
+		value = config.Mask
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", key, value)
+	}
+	return fmt.Sprintf("%s: %s", key, data)
+}
@@ -0,0 +1,117 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/DamienFontaine/lunarc/config"
+	"gopkg.in/yaml.v2"
+)
+
+func TestPrintConfig(t *testing.T) {
+	var out bytes.Buffer
+	if err := printConfig([]string{"testdata/config.yml", "production"}, nil, &out); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if strings.Contains(out.String(), "ProductionSecretKey") || strings.Contains(out.String(), "StagingPassword") {
+		t.Fatalf("Must mask the secrets but %v", out.String())
+	}
+	var tree map[string]map[string]interface{}
+	if err := yaml.Unmarshal(out.Bytes(), &tree); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if tree["server"]["port"] != 9000 {
+		t.Fatalf("Non expected server.port: %v", tree["server"]["port"])
+	}
+	if tree["mongo"]["host"] != "127.0.0.1" {
+		t.Fatalf("Must inherit mongo.host but %v", tree["mongo"]["host"])
+	}
+	if tree["mongo"]["password"] != config.Mask {
+		t.Fatalf("Must mask mongo.password but %v", tree["mongo"]["password"])
+	}
+	if _, ok := tree["smtp"]; ok {
+		t.Fatalf("Must only print the sections of the environment")
+	}
+}
+
+func TestPrintConfigJSONWithOverride(t *testing.T) {
+	os.Setenv("LUNARC_PRODUCTION_SERVER_PORT", "9443")
+	defer os.Unsetenv("LUNARC_PRODUCTION_SERVER_PORT")
+
+	var out bytes.Buffer
+	args := []string{"-format", "json", "-show-secrets", "testdata/config.yml", "production"}
+	if err := printConfig(args, nil, &out); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	var tree map[string]map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &tree); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if tree["server"]["port"] != float64(9443) {
+		t.Fatalf("Must apply the environment variables but %v", tree["server"]["port"])
+	}
+	if !strings.Contains(out.String(), "ProductionSecretKey") {
+		t.Fatalf("Must show the secrets but %v", out.String())
+	}
+}
+
+func TestPrintConfigDiff(t *testing.T) {
+	var out bytes.Buffer
+	if err := printConfig([]string{"-diff", "production", "testdata/config.yml", "staging"}, nil, &out); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	expected := `--- staging
++++ production
+-server.jwt.key: "********"
++server.jwt.key: "********"
+-server.log.level: "DEBUG"
++server.log.level: "INFO"
+-server.port: 8888
++server.port: 9000
+`
+	if out.String() != expected {
+		t.Fatalf("Non expected diff:\n%v", out.String())
+	}
+}
+
+func TestPrintConfigInvalid(t *testing.T) {
+	var out bytes.Buffer
+	err := printConfig([]string{"testdata/config.yml", "broken"}, nil, &out)
+	if err == nil || !strings.Contains(err.Error(), "server.port") {
+		t.Fatalf("Must report server.port but %v", err)
+	}
+	if !strings.Contains(out.String(), "port: 70000") {
+		t.Fatalf("Must print an invalid configuration but %v", out.String())
+	}
+}
+
+func TestPrintConfigErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"testdata/config.yml"},
+		{"testdata/config.yml", "development"},
+		{"-format", "xml", "testdata/config.yml", "staging"},
+		{"-diff", "development", "testdata/config.yml", "staging"},
+	} {
+		if err := printConfig(args, nil, &bytes.Buffer{}); err == nil {
+			t.Fatalf("Expected error for %v!", args)
+		}
+	}
+}
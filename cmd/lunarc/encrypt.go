@@ -0,0 +1,64 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/DamienFontaine/lunarc/config"
+)
+
+//keygen prints a new master key
+func keygen(args []string, in io.Reader, out io.Writer) error {
+	key, err := config.GenerateKey()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, key)
+	return err
+}
+
+//encrypt prints the encrypted value of its argument or, without argument, of
+//the first line of its input so that secrets stay out of the shell history.
+func encrypt(args []string, in io.Reader, out io.Writer) error {
+	var value string
+	switch len(args) {
+	case 0:
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		value = strings.TrimRight(line, "\r\n")
+	case 1:
+		value = args[0]
+	default:
+		return errors.New("too many arguments")
+	}
+	key, err := config.MasterKey()
+	if err != nil {
+		return err
+	}
+	encrypted, err := config.Encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, encrypted)
+	return err
+}
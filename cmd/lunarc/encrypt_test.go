@@ -0,0 +1,65 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/DamienFontaine/lunarc/config"
+)
+
+func TestKeygen(t *testing.T) {
+	var out bytes.Buffer
+	if err := keygen(nil, nil, &out); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(out.String()))
+	if err != nil || len(key) != config.KeySize {
+		t.Fatalf("Must print a %d bytes key but %v", config.KeySize, out.String())
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	encoded, _ := config.GenerateKey()
+	key, _ := base64.StdEncoding.DecodeString(encoded)
+	os.Setenv(config.MasterKeyEnv, encoded)
+	defer os.Unsetenv(config.MasterKeyEnv)
+
+	for _, args := range [][]string{{"doe"}, nil} {
+		var out bytes.Buffer
+		if err := encrypt(args, strings.NewReader("doe\n"), &out); err != nil {
+			t.Fatalf("Non expected error: %v", err)
+		}
+		value, err := config.Decrypt(key, strings.TrimSpace(out.String()))
+		if err != nil {
+			t.Fatalf("Non expected error: %v", err)
+		}
+		if value != "doe" {
+			t.Fatalf("Must encrypt doe but %v", value)
+		}
+	}
+}
+
+func TestEncryptWithoutKey(t *testing.T) {
+	var out bytes.Buffer
+	if err := encrypt([]string{"doe"}, nil, &out); err == nil {
+		t.Fatalf("Expected error!")
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+//Lunarc command line tool.
+//
+//	lunarc keygen              prints a new master key
+//	lunarc encrypt [value]     encrypts a configuration value with the master key
+//	lunarc config [flags] file environment
+//	                           prints the effective configuration of an environment
+//
+//The master key is read from LUNARC_MASTER_KEY or from the file named by
+//LUNARC_MASTER_KEY_FILE.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+type command struct {
+	usage string
+	run   func(args []string, in io.Reader, out io.Writer) error
+}
+
+var commands = map[string]command{
+	"keygen":  {"keygen", keygen},
+	"encrypt": {"encrypt [value]", encrypt},
+	"config":  {"config [-format yaml|json] [-diff environment] [-show-secrets] file environment", printConfig},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "lunarc %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	for _, name := range []string{"keygen", "encrypt", "config"} {
+		fmt.Fprintf(os.Stderr, "\tlunarc %s\n", commands[name].usage)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"gopkg.in/yaml.v2"
+)
+
+//Defaults sets the zero fields of conf, a pointer to a config struct, to the value
+//of their default tag, e.g. `default:"27017"` or `default:"10s"`. The values are
+//read the way the YAML decoder reads the configuration files. Keys are reported
+//from prefix.
+func Defaults(conf interface{}, prefix string) (errs Errors) {
+	value := reflect.ValueOf(conf)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return Errors{{Key: prefix, Err: fmt.Errorf("defaults need a non-nil pointer, not %T", conf)}}
+	}
+	defaults(value.Elem(), prefix, &errs)
+	return
+}
+
+func defaults(value reflect.Value, path string, errs *Errors) {
+	if value.Kind() != reflect.Struct {
+		return
+	}
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, inline, ok := keyOf(field)
+		if !ok {
+			continue
+		}
+		child := join(path, name)
+		if inline {
+			child = path
+		}
+		fieldValue := value.Field(i)
+		if tag, ok := field.Tag.Lookup("default"); ok && isZero(fieldValue) {
+			target := reflect.New(field.Type)
+			if err := yaml.Unmarshal([]byte(tag), target.Interface()); err != nil {
+				*errs = append(*errs, &Error{Key: child, Err: fmt.Errorf("bad default %q: %v", tag, err)})
+				continue
+			}
+			fieldValue.Set(target.Elem())
+		}
+		defaults(reflect.Indirect(fieldValue), child, errs)
+	}
+}
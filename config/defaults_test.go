@@ -0,0 +1,94 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+//DefaultConfig has default values
+type DefaultConfig struct {
+	Port    int           `default:"27017" validate:"required"`
+	Host    string        `default:"localhost"`
+	Timeout time.Duration `default:"10s"`
+	Hosts   []string      `default:"[a, b]"`
+	Log     struct {
+		Level string `default:"ERROR"`
+	}
+}
+
+//BadDefaultConfig has a default value of the wrong type
+type BadDefaultConfig struct {
+	Port int `default:"http"`
+}
+
+func init() {
+	Register("defaults", DefaultConfig{})
+	Register("baddefaults", BadDefaultConfig{})
+}
+
+func TestDefaults(t *testing.T) {
+	conf := DefaultConfig{Host: "mongo"}
+	if errs := Defaults(&conf, "defaults"); len(errs) > 0 {
+		t.Fatalf("Non expected error: %v", errs)
+	}
+	if conf.Port != 27017 || conf.Timeout != 10*time.Second || conf.Log.Level != "ERROR" {
+		t.Fatalf("Must set the defaults but %+v", conf)
+	}
+	if len(conf.Hosts) != 2 || conf.Hosts[1] != "b" {
+		t.Fatalf("Must set the default list but %v", conf.Hosts)
+	}
+	if conf.Host != "mongo" {
+		t.Fatalf("Must keep the configured values but %v", conf.Host)
+	}
+	if errs := Defaults(conf, "defaults"); len(errs) == 0 {
+		t.Fatalf("Expected error without a pointer!")
+	}
+}
+
+func TestLoaderSectionDefaults(t *testing.T) {
+	var data = `
+  test:
+    defaults:
+      host: mongo
+      timeout: 1m
+    baddefaults:
+      port: 0`
+
+	loader, err := NewLoader([]byte(data), "test")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	var conf DefaultConfig
+	if err = loader.Section("defaults", &conf); err != nil {
+		t.Fatalf("The defaults must be set before the validation but %v", err)
+	}
+	if conf.Port != 27017 || conf.Timeout != time.Minute {
+		t.Fatalf("Non expected configuration: %+v", conf)
+	}
+
+	tree, _, _ := loader.Effective()
+	if leaves := Flatten(tree); leaves["defaults.log.level"] != "ERROR" {
+		t.Fatalf("The effective configuration must show the defaults but %v", leaves)
+	}
+
+	err = loader.Section("baddefaults", &BadDefaultConfig{})
+	if err == nil || !strings.Contains(err.Error(), "baddefaults.port: bad default") {
+		t.Fatalf("Must report the bad default but %v", err)
+	}
+}
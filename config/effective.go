@@ -0,0 +1,189 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+//Mask replaces the secret values of a redacted configuration
+const Mask = "********"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+//Effective returns the values of every registered section declared by the environment,
+//as the application sees them, and the keys of their secrets: the fields tagged
+//`secret:"true"` and the values encrypted in the sources. The sections which fail
+//their validation are returned too, along with the errors.
+func (l *Loader) Effective() (tree map[string]interface{}, secrets map[string]bool, err error) {
+	tree = make(map[string]interface{})
+	secrets = make(map[string]bool)
+	for key := range l.doc.encrypted {
+		secrets[key] = true
+	}
+	var errs Errors
+	for _, name := range Sections() {
+		if !l.Has(name) {
+			continue
+		}
+		sectionsMu.RLock()
+		t := sections[name]
+		sectionsMu.RUnlock()
+		value := reflect.New(t)
+		if e := l.Section(name, value.Interface()); e != nil {
+			if list, ok := e.(Errors); ok {
+				errs = append(errs, list...)
+			} else {
+				errs = append(errs, &Error{Environment: l.environment, Key: name, Err: e})
+			}
+		}
+		tree[name] = Values(value.Elem().Interface(), name, secrets)
+	}
+	if len(errs) > 0 {
+		err = errs
+	}
+	return
+}
+
+//Values returns the generic tree of a config struct with the keys the YAML decoder
+//reads. The keys of the fields tagged `secret:"true"` are added to secrets when it is not nil.
+func Values(conf interface{}, prefix string, secrets map[string]bool) interface{} {
+	return values(reflect.ValueOf(conf), prefix, secrets)
+}
+
+func values(value reflect.Value, path string, secrets map[string]bool) interface{} {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return nil
+	}
+	if value.Type() == durationType {
+		return value.Interface().(time.Duration).String()
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		m := make(map[string]interface{})
+		structValues(value, path, m, secrets)
+		return m
+	case reflect.Map:
+		m := make(map[string]interface{}, value.Len())
+		for _, key := range value.MapKeys() {
+			name := fmt.Sprint(key.Interface())
+			m[name] = values(value.MapIndex(key), join(path, name), secrets)
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return nil
+		}
+		l := make([]interface{}, value.Len())
+		for i := range l {
+			l[i] = values(value.Index(i), join(path, strconv.Itoa(i)), secrets)
+		}
+		return l
+	}
+	return value.Interface()
+}
+
+func structValues(value reflect.Value, path string, m map[string]interface{}, secrets map[string]bool) {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, inline, ok := keyOf(field)
+		if !ok {
+			continue
+		}
+		if inline {
+			structValues(reflect.Indirect(value.Field(i)), path, m, secrets)
+			continue
+		}
+		key := join(path, name)
+		if secrets != nil && field.Tag.Get("secret") == "true" {
+			secrets[key] = true
+		}
+		m[name] = values(value.Field(i), key, secrets)
+	}
+}
+
+//Redact returns a copy of tree where the values of secrets are replaced by Mask.
+//Empty secrets are kept to show that they are not set.
+func Redact(tree map[string]interface{}, secrets map[string]bool) map[string]interface{} {
+	return redact(tree, "", secrets).(map[string]interface{})
+}
+
+func redact(value interface{}, path string, secrets map[string]bool) interface{} {
+	if secrets[path] && !isEmpty(value) {
+		return Mask
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			m[key] = redact(child, join(path, key), secrets)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, child := range v {
+			l[i] = redact(child, join(path, strconv.Itoa(i)), secrets)
+		}
+		return l
+	}
+	return value
+}
+
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	return isZero(v)
+}
+
+//Flatten returns the leaves of tree by key, e.g. "server.port"
+func Flatten(tree map[string]interface{}) map[string]interface{} {
+	leaves := make(map[string]interface{})
+	flatten(tree, "", leaves)
+	return leaves
+}
+
+func flatten(value interface{}, path string, leaves map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 && len(path) > 0 {
+			leaves[path] = v
+		}
+		for key, child := range v {
+			flatten(child, join(path, key), leaves)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			leaves[path] = v
+		}
+		for i, child := range v {
+			flatten(child, join(path, strconv.Itoa(i)), leaves)
+		}
+	default:
+		leaves[path] = value
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"encoding/base64"
+	"os"
+	"testing"
+	"time"
+)
+
+//SecretConfig has a secret field
+type SecretConfig struct {
+	User     string
+	Password string `secret:"true"`
+	Timeout  time.Duration
+}
+
+func init() {
+	Register("secret", SecretConfig{})
+}
+
+func TestEffective(t *testing.T) {
+	encoded, _ := GenerateKey()
+	key, _ := base64.StdEncoding.DecodeString(encoded)
+	os.Setenv(MasterKeyEnv, encoded)
+	defer os.Unsetenv(MasterKeyEnv)
+	file, _ := Encrypt(key, "/var/log/secret.log")
+
+	var data = `
+  test:
+    testconfig:
+      port: 8888
+      log:
+        file: ` + file + `
+    secret:
+      user: doe
+      password: LunarcSecretKey
+      timeout: 5s
+    valid:
+      port: 0`
+
+	loader, err := NewLoader([]byte(data), "test")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	tree, secrets, err := loader.Effective()
+	if err == nil {
+		t.Fatalf("Expected error for valid.port!")
+	}
+	if tree["valid"] == nil {
+		t.Fatalf("Must return the invalid sections too")
+	}
+	if _, ok := tree["smtp"]; ok {
+		t.Fatalf("Must only return the sections of the environment")
+	}
+	leaves := Flatten(tree)
+	if leaves["testconfig.port"] != 8888 {
+		t.Fatalf("Non expected testconfig.port: %v", leaves["testconfig.port"])
+	}
+	if leaves["testconfig.log.file"] != "/var/log/secret.log" {
+		t.Fatalf("Must decrypt testconfig.log.file but %v", leaves["testconfig.log.file"])
+	}
+	if leaves["secret.timeout"] != "5s" {
+		t.Fatalf("Must print the durations but %v", leaves["secret.timeout"])
+	}
+	for _, key := range []string{"secret.password", "testconfig.log.file"} {
+		if !secrets[key] {
+			t.Fatalf("%s must be a secret", key)
+		}
+	}
+
+	redacted := Flatten(Redact(tree, secrets))
+	if redacted["secret.password"] != Mask || redacted["testconfig.log.file"] != Mask {
+		t.Fatalf("Must mask the secrets but %v", redacted)
+	}
+	if redacted["secret.user"] != "doe" {
+		t.Fatalf("Must keep the other values but %v", redacted["secret.user"])
+	}
+	if leaves["secret.password"] != "LunarcSecretKey" {
+		t.Fatalf("Redact must not modify the tree")
+	}
+}
+
+func TestRedactEmptySecret(t *testing.T) {
+	tree := map[string]interface{}{"secret": Values(SecretConfig{User: "doe"}, "secret", nil)}
+	secrets := map[string]bool{"secret.password": true}
+	if value := Flatten(Redact(tree, secrets))["secret.password"]; value != "" {
+		t.Fatalf("Must keep an empty secret but %v", value)
+	}
+}
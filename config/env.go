@@ -0,0 +1,164 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Prefix of the environment variables overriding configuration values
+var Prefix = "LUNARC"
+
+var (
+	variable = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+	integer  = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+	unsafe   = regexp.MustCompile(`[^A-Z0-9]+`)
+)
+
+//Interpolate replaces ${VAR} and ${VAR:-default} in every string value of the tree.
+//$${ is kept as a literal ${.
+func Interpolate(tree map[string]interface{}) {
+	for key, value := range tree {
+		tree[key] = interpolate(value)
+	}
+}
+
+func interpolate(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		Interpolate(v)
+	case []interface{}:
+		for i, child := range v {
+			v[i] = interpolate(child)
+		}
+	case string:
+		return expand(v)
+	}
+	return value
+}
+
+//expand substitutes the variables of s. A value made of a single variable is typed
+//so that ${PORT} can fill an integer field.
+func expand(s string) interface{} {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+	whole := false
+	if loc := variable.FindStringIndex(s); loc != nil && loc[0] == 0 && loc[1] == len(s) && s != "$${" {
+		whole = true
+	}
+	result := variable.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+		groups := variable.FindStringSubmatch(match)
+		if value, ok := os.LookupEnv(groups[1]); ok && (value != "" || groups[2] == "") {
+			return value
+		}
+		if groups[2] == "" {
+			log.Printf("Warning: environment variable %s is not set", groups[1])
+		}
+		return groups[3]
+	})
+	if whole {
+		return scalar(result)
+	}
+	return result
+}
+
+//Override applies the environment variables named PREFIX_ENVIRONMENT_KEY_PATH to the
+//environment of the tree, e.g. LUNARC_PRODUCTION_SERVER_PORT sets production.server.port.
+func Override(tree map[string]interface{}, environment string, environ []string) {
+	prefix := Prefix + "_" + envName(environment) + "_"
+	sort.Strings(environ)
+	for _, kv := range environ {
+		i := strings.Index(kv, "=")
+		if i < 0 || !strings.HasPrefix(kv[:i], prefix) || len(kv[:i]) == len(prefix) {
+			continue
+		}
+		env, ok := tree[environment].(map[string]interface{})
+		if !ok {
+			env = make(map[string]interface{})
+			tree[environment] = env
+		}
+		created, ok := set(env, strings.Split(kv[len(prefix):i], "_"), scalar(kv[i+1:]))
+		if !ok {
+			log.Printf("Warning: %s does not match a configuration value", kv[:i])
+		} else if created {
+			log.Printf("Warning: %s does not match a configuration value, it is added", kv[:i])
+		}
+	}
+}
+
+//set assigns value at path. A key of the tree matches one or several segments
+//of the path so that keys containing an underscore can be overridden. The
+//missing keys are created, created is then true. ok is false when a value which
+//is not a mapping is on the path.
+func set(tree map[string]interface{}, path []string, value interface{}) (created, ok bool) {
+	for n := len(path); n > 0; n-- {
+		name := strings.Join(path[:n], "_")
+		for key, child := range tree {
+			if envName(key) != envName(name) {
+				continue
+			}
+			if n == len(path) {
+				tree[key] = value
+				return false, true
+			}
+			if m, ok := child.(map[string]interface{}); ok {
+				return set(m, path[n:], value)
+			}
+			return false, false
+		}
+	}
+	key := strings.ToLower(path[0])
+	if len(path) == 1 {
+		tree[key] = value
+		return true, true
+	}
+	m := make(map[string]interface{})
+	tree[key] = m
+	_, ok = set(m, path[1:], value)
+	return true, ok
+}
+
+//envName returns name as it appears in an environment variable
+func envName(name string) string {
+	return strings.Trim(unsafe.ReplaceAllString(strings.ToUpper(name), "_"), "_")
+}
+
+//scalar types a raw value the way the YAML decoder would for integers and booleans.
+//Other values, e.g. 0123, -0 or 1.50, stay strings so that secrets are never altered.
+func scalar(s string) interface{} {
+	switch {
+	case s == "":
+		return nil
+	case s == "true":
+		return true
+	case s == "false":
+		return false
+	case integer.MatchString(s):
+		if i, err := strconv.Atoi(s); err == nil && strconv.Itoa(i) == s {
+			return i
+		}
+	}
+	return s
+}
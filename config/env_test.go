@@ -0,0 +1,186 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestInterpolateNormal(t *testing.T) {
+	os.Setenv("LUNARC_TEST_HOST", "mongo")
+	os.Setenv("LUNARC_TEST_PORT", "9999")
+	defer os.Unsetenv("LUNARC_TEST_HOST")
+	defer os.Unsetenv("LUNARC_TEST_PORT")
+
+	tree := map[string]interface{}{
+		"test": map[string]interface{}{
+			"host":    "${LUNARC_TEST_HOST}",
+			"port":    "${LUNARC_TEST_PORT}",
+			"url":     "http://${LUNARC_TEST_HOST}:${LUNARC_TEST_PORT}/",
+			"level":   "${LUNARC_TEST_LEVEL:-DEBUG}",
+			"literal": "$${LUNARC_TEST_HOST}",
+			"list":    []interface{}{"${LUNARC_TEST_HOST}"},
+		},
+	}
+	Interpolate(tree)
+
+	test := tree["test"].(map[string]interface{})
+	if test["host"] != "mongo" {
+		t.Fatalf("Must return mongo but %v", test["host"])
+	}
+	if test["port"] != 9999 {
+		t.Fatalf("Must return the integer 9999 but %#v", test["port"])
+	}
+	if test["url"] != "http://mongo:9999/" {
+		t.Fatalf("Must return http://mongo:9999/ but %v", test["url"])
+	}
+	if test["level"] != "DEBUG" {
+		t.Fatalf("Must return the default value DEBUG but %v", test["level"])
+	}
+	if test["literal"] != "${LUNARC_TEST_HOST}" {
+		t.Fatalf("Must return a literal ${LUNARC_TEST_HOST} but %v", test["literal"])
+	}
+	if test["list"].([]interface{})[0] != "mongo" {
+		t.Fatalf("Must interpolate lists but %v", test["list"])
+	}
+}
+
+func TestInterpolateKeepSecrets(t *testing.T) {
+	os.Setenv("LUNARC_TEST_PASSWORD", "0123")
+	defer os.Unsetenv("LUNARC_TEST_PASSWORD")
+
+	tree := map[string]interface{}{"password": "${LUNARC_TEST_PASSWORD}"}
+	Interpolate(tree)
+
+	if tree["password"] != "0123" {
+		t.Fatalf("Must return the string 0123 but %#v", tree["password"])
+	}
+	for _, secret := range []string{"-0", "+1", "-012"} {
+		if v := scalar(secret); v != secret {
+			t.Fatalf("Must return the string %s but %#v", secret, v)
+		}
+	}
+	if v := scalar("-42"); v != -42 {
+		t.Fatalf("Must return the integer -42 but %#v", v)
+	}
+}
+
+func TestOverrideNormal(t *testing.T) {
+	tree := map[string]interface{}{
+		"production": map[string]interface{}{
+			"server": map[string]interface{}{"port": 8888},
+		},
+		"test": map[string]interface{}{
+			"server": map[string]interface{}{"port": 8888},
+		},
+	}
+	environ := []string{
+		"LUNARC_PRODUCTION_SERVER_PORT=9000",
+		"LUNARC_PRODUCTION_SERVER_JWT_KEY=secret",
+		"LUNARC_TEST_SERVER_PORT=7000",
+		"PATH=/bin",
+	}
+	Override(tree, "production", environ)
+
+	server := tree["production"].(map[string]interface{})["server"].(map[string]interface{})
+	if server["port"] != 9000 {
+		t.Fatalf("Must return 9000 but %v", server["port"])
+	}
+	jwt, ok := server["jwt"].(map[string]interface{})
+	if !ok || jwt["key"] != "secret" {
+		t.Fatalf("Must create server.jwt.key but %v", server)
+	}
+	test := tree["test"].(map[string]interface{})["server"].(map[string]interface{})
+	if test["port"] != 8888 {
+		t.Fatalf("Must not override an other environment but %v", test["port"])
+	}
+}
+
+func TestOverrideWarnings(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	tree := map[string]interface{}{
+		"production": map[string]interface{}{
+			"server": map[string]interface{}{"port": 8888},
+		},
+	}
+	Override(tree, "production", []string{
+		"LUNARC_PRODUCTION_SERVER_PORT=9000",
+		"LUNARC_PRODUCTION_SERVER_PROT=9000",
+		"LUNARC_PRODUCTION_SERVER_PORT_NUMBER=9000",
+	})
+	logged := buf.String()
+	if strings.Contains(logged, "LUNARC_PRODUCTION_SERVER_PORT does not match") {
+		t.Fatalf("Must not warn about an existing key: %s", logged)
+	}
+	if !strings.Contains(logged, "LUNARC_PRODUCTION_SERVER_PROT does not match a configuration value, it is added") {
+		t.Fatalf("Must warn about a created key: %s", logged)
+	}
+	if !strings.Contains(logged, "LUNARC_PRODUCTION_SERVER_PORT_NUMBER does not match a configuration value\n") {
+		t.Fatalf("Must warn about a key below a value: %s", logged)
+	}
+}
+
+func TestOverrideMixedCaseEnvironment(t *testing.T) {
+	tree := map[string]interface{}{
+		"testNoLog": map[string]interface{}{
+			"mongo": map[string]interface{}{"host": "mongo"},
+		},
+	}
+	Override(tree, "testNoLog", []string{"LUNARC_TESTNOLOG_MONGO_HOST=localhost"})
+
+	mongo := tree["testNoLog"].(map[string]interface{})["mongo"].(map[string]interface{})
+	if mongo["host"] != "localhost" {
+		t.Fatalf("Must return localhost but %v", mongo["host"])
+	}
+}
+
+func TestGetWithEnvironment(t *testing.T) {
+	os.Setenv("LUNARC_TEST_TESTCONFIG_PORT", "9000")
+	os.Setenv("LUNARC_TEST_LOG_LEVEL", "INFO")
+	defer os.Unsetenv("LUNARC_TEST_TESTCONFIG_PORT")
+	defer os.Unsetenv("LUNARC_TEST_LOG_LEVEL")
+
+	var data = `
+  test:
+    testconfig:
+      port: 8888
+      log:
+        level: ${LUNARC_TEST_LOG_LEVEL:-DEBUG}
+        file: ${LUNARC_TEST_LOG_FILE:-./logs/}`
+
+	var testEnvironment TestEnvironment
+	i, err := Get([]byte(data), "test", &testEnvironment)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	test := i.(TestConfig)
+	if test.Port != 9000 {
+		t.Fatalf("Non expected server port: %v != %v", 9000, test.Port)
+	}
+	if strings.Compare(test.Log.Level, "INFO") != 0 {
+		t.Fatalf("Non expected log level: %v != %v", "INFO", test.Log.Level)
+	}
+	if strings.Compare(test.Log.File, "./logs/") != 0 {
+		t.Fatalf("Non expected log file: %v != %v", "./logs/", test.Log.File)
+	}
+}
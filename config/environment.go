@@ -19,3 +19,9 @@ package config
 type Environment interface {
 	GetEnvironment(string) interface{}
 }
+
+//Section is implemented by an Environment reading a single section of every
+//environment, e.g. "server". Get reports the unknown keys of that section.
+type Section interface {
+	Section() string
+}
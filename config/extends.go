@@ -0,0 +1,118 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//Extends is the key of an environment naming its parent environment
+const Extends = "extends"
+
+//Inherit resolves the parent chain of every environment of the tree. An environment
+//declaring "extends: production" starts from a copy of production and overrides
+//only the values it declares.
+func Inherit(tree map[string]interface{}) error {
+	resolved := make(map[string]bool)
+	var names []string
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := inherit(tree, name, resolved, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//InheritEnvironment resolves the parent chain of environment only, the errors of
+//the other environments being left to their own loading.
+func InheritEnvironment(tree map[string]interface{}, environment string) error {
+	return inherit(tree, environment, make(map[string]bool), nil)
+}
+
+func inherit(tree map[string]interface{}, name string, resolved map[string]bool, chain []string) error {
+	if resolved[name] {
+		return nil
+	}
+	for i, parent := range chain {
+		if parent == name {
+			return fmt.Errorf("environment %s: cyclic extends %s", chain[0], strings.Join(append(chain[i:], name), " -> "))
+		}
+	}
+	env, ok := tree[name].(map[string]interface{})
+	if !ok {
+		resolved[name] = true
+		return nil
+	}
+	value, ok := env[Extends]
+	if !ok {
+		resolved[name] = true
+		return nil
+	}
+	parent, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("environment %s: %s must be an environment name", name, Extends)
+	}
+	if _, ok := tree[parent].(map[string]interface{}); !ok {
+		return fmt.Errorf("environment %s extends unknown environment %s", name, parent)
+	}
+	if err := inherit(tree, parent, resolved, append(chain, name)); err != nil {
+		return err
+	}
+	delete(env, Extends)
+	merged := clone(tree[parent]).(map[string]interface{})
+	Merge(merged, env)
+	tree[name] = merged
+	resolved[name] = true
+	return nil
+}
+
+//parents returns the parent of every environment declaring one
+func parents(tree map[string]interface{}) map[string]string {
+	p := make(map[string]string)
+	for name, value := range tree {
+		if env, ok := value.(map[string]interface{}); ok {
+			if parent, ok := env[Extends].(string); ok {
+				p[name] = parent
+			}
+		}
+	}
+	return p
+}
+
+//clone returns a deep copy of a tree value
+func clone(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			m[key] = clone(child)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, child := range v {
+			l[i] = clone(child)
+		}
+		return l
+	}
+	return value
+}
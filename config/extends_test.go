@@ -0,0 +1,113 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetWithExtends(t *testing.T) {
+	var data = `
+  production:
+    testconfig:
+      port: 8888
+      log:
+        file: ./logs/
+        level: ERROR
+  staging:
+    extends: production
+    testconfig:
+      log:
+        level: DEBUG
+  preprod:
+    extends: staging
+    testconfig:
+      port: 9000`
+
+	var testEnvironment TestEnvironment
+	i, err := Get([]byte(data), "preprod", &testEnvironment)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	test := i.(TestConfig)
+	if test.Port != 9000 {
+		t.Fatalf("Non expected server port: %v != %v", 9000, test.Port)
+	}
+	if strings.Compare(test.Log.Level, "DEBUG") != 0 {
+		t.Fatalf("Non expected log level: %v != %v", "DEBUG", test.Log.Level)
+	}
+	if strings.Compare(test.Log.File, "./logs/") != 0 {
+		t.Fatalf("Non expected log file: %v != %v", "./logs/", test.Log.File)
+	}
+
+	i, _ = Get([]byte(data), "production", &testEnvironment)
+	production := i.(TestConfig)
+	if production.Port != 8888 || strings.Compare(production.Log.Level, "ERROR") != 0 {
+		t.Fatalf("Parent environment must not be modified: %v", production)
+	}
+}
+
+func TestInheritCycle(t *testing.T) {
+	tree := map[string]interface{}{
+		"a": map[string]interface{}{Extends: "b"},
+		"b": map[string]interface{}{Extends: "c"},
+		"c": map[string]interface{}{Extends: "a"},
+	}
+	err := Inherit(tree)
+	if err == nil {
+		t.Fatalf("Expected error!")
+	}
+	if !strings.Contains(err.Error(), "a -> b -> c -> a") {
+		t.Fatalf("Must report the cycle but %v", err)
+	}
+}
+
+func TestInheritUnknownParent(t *testing.T) {
+	tree := map[string]interface{}{
+		"staging": map[string]interface{}{Extends: "prod"},
+	}
+	if err := Inherit(tree); err == nil {
+		t.Fatalf("Expected error!")
+	}
+}
+
+func TestInheritEnvironment(t *testing.T) {
+	var data = `
+production:
+  testconfig:
+    port: 8888
+staging:
+  extends: qa
+qa:
+  extends: staging
+preprod:
+  extends: production
+  testconfig:
+    port: 9000
+`
+	var testEnvironment TestEnvironment
+	i, err := Get([]byte(data), "preprod", &testEnvironment)
+	if err != nil {
+		t.Fatalf("An invalid environment must not fail the others: %v", err)
+	}
+	if port := i.(TestConfig).Port; port != 9000 {
+		t.Fatalf("Non expected port: %v", port)
+	}
+	if _, err := Get([]byte(data), "staging", &testEnvironment); err == nil || !strings.Contains(err.Error(), "staging -> qa -> staging") {
+		t.Fatalf("Must report the cycle of staging but %v", err)
+	}
+}
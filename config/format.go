@@ -0,0 +1,111 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+//Format of a configuration source
+type Format int
+
+//Supported formats
+const (
+	YAML Format = iota
+	JSON
+	TOML
+)
+
+func (f Format) String() string {
+	switch f {
+	case JSON:
+		return "json"
+	case TOML:
+		return "toml"
+	}
+	return "yaml"
+}
+
+var (
+	tomlTable = regexp.MustCompile(`^\[\[?[A-Za-z0-9_."' -]+\]\]?$`)
+	tomlKey   = regexp.MustCompile(`^[A-Za-z0-9_."'-]+\s*=`)
+)
+
+//FormatOf returns the format of a source from the extension of its filename or,
+//when the extension is unknown, from its content.
+func FormatOf(filename string, data []byte) Format {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yml", ".yaml":
+		return YAML
+	case ".json":
+		return JSON
+	case ".toml":
+		return TOML
+	}
+	return sniff(data)
+}
+
+//sniff guesses the format of data from its first significant line. A document
+//starting with { which is not valid JSON is a YAML flow mapping.
+func sniff(data []byte) Format {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		if json.Valid(data) {
+			return JSON
+		}
+		return YAML
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+		if tomlTable.MatchString(line) || tomlKey.MatchString(line) {
+			return TOML
+		}
+		break
+	}
+	return YAML
+}
+
+//decode returns the generic tree of data
+func decode(format Format, data []byte) (raw interface{}, err error) {
+	switch format {
+	case JSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err = decoder.Decode(&raw); err != nil {
+			return
+		}
+	case TOML:
+		var m map[string]interface{}
+		if _, err = toml.Decode(string(data), &m); err != nil {
+			return
+		}
+		raw = m
+	default:
+		err = yaml.Unmarshal(data, &raw)
+	}
+	return
+}
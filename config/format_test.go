@@ -0,0 +1,109 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestFormatOf(t *testing.T) {
+	var tests = []struct {
+		filename string
+		data     string
+		format   Format
+	}{
+		{"config.yml", "", YAML},
+		{"config.yaml", "", YAML},
+		{"config.json", "", JSON},
+		{"config.TOML", "", TOML},
+		{"", "test:\n  testconfig:\n    port: 8888", YAML},
+		{"", "  {\"test\": {}}", JSON},
+		{"", "{test: {testconfig: {port: 8888}}}", YAML},
+		{"", "# comment\n\n[test.testconfig]\nport = 8888", TOML},
+		{"", "title = \"lunarc\"", TOML},
+	}
+	for _, test := range tests {
+		if format := FormatOf(test.filename, []byte(test.data)); format != test.format {
+			t.Fatalf("Must return %v for %q but %v", test.format, test.filename+test.data, format)
+		}
+	}
+}
+
+func TestGetWithYAMLFlowMapping(t *testing.T) {
+	var testEnvironment TestEnvironment
+	i, err := Get([]byte("{test: {testconfig: {port: 8888}}}"), "test", &testEnvironment)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if port := i.(TestConfig).Port; port != 8888 {
+		t.Fatalf("Non expected port: %v", port)
+	}
+}
+
+func TestGetWithJSONFile(t *testing.T) {
+	var testEnvironment TestEnvironment
+	i, err := Get("formats/config.json", "test", &testEnvironment)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	test := i.(TestConfig)
+	if test.Port != 8888 {
+		t.Fatalf("Non expected server port: %v != %v", 8888, test.Port)
+	}
+	if strings.Compare(test.Log.Level, "DEBUG") != 0 {
+		t.Fatalf("Non expected log level: %v != %v", "DEBUG", test.Log.Level)
+	}
+}
+
+func TestGetWithTOMLFile(t *testing.T) {
+	var testEnvironment TestEnvironment
+	i, err := Get("formats/config.toml", "test", &testEnvironment)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	test := i.(TestConfig)
+	if test.Port != 8888 {
+		t.Fatalf("Non expected server port: %v != %v", 8888, test.Port)
+	}
+	if strings.Compare(test.Log.File, "./logs/") != 0 {
+		t.Fatalf("Non expected log file: %v != %v", "./logs/", test.Log.File)
+	}
+}
+
+func TestGetWithTOMLByte(t *testing.T) {
+	data, err := ioutil.ReadFile("formats/config.toml")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	var testEnvironment TestEnvironment
+	i, err := Get(data, "test", &testEnvironment)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if test := i.(TestConfig); test.Port != 8888 {
+		t.Fatalf("Non expected server port: %v != %v", 8888, test.Port)
+	}
+}
+
+func TestGetWithBadJSON(t *testing.T) {
+	var testEnvironment TestEnvironment
+	_, err := Get([]byte(`{"test": {"testconfig": {"port": 8888}`), "test", &testEnvironment)
+	if err == nil {
+		t.Fatalf("Expected error!")
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	sectionsMu sync.RWMutex
+	sections   = make(map[string]reflect.Type)
+)
+
+//Register makes a section known to every Loader. name is the key of the section in
+//an environment and prototype a value of its config struct, e.g.
+//config.Register("server", web.Config{}).
+func Register(name string, prototype interface{}) {
+	t := reflect.TypeOf(prototype)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("config: section %s must be a struct, not %T", name, prototype))
+	}
+	sectionsMu.Lock()
+	defer sectionsMu.Unlock()
+	sections[name] = t
+}
+
+//Sections returns the names of the registered sections
+func Sections() (names []string) {
+	sectionsMu.RLock()
+	defer sectionsMu.RUnlock()
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+//Loader parses a configuration once and hands out the sections of an environment
+type Loader struct {
+	source      interface{}
+	environment string
+	doc         document
+	chain       map[string]string
+	env         map[string]interface{}
+}
+
+//NewLoader loads the environment of source. See Load for the accepted sources.
+func NewLoader(source interface{}, environment string) (*Loader, error) {
+	doc, chain, err := prepare(source, environment)
+	if err != nil {
+		return nil, err
+	}
+	env, ok := doc.tree[environment].(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("No configuration for environment %s", environment)
+		log.Printf("Fatal: %v", err)
+		return nil, err
+	}
+	return &Loader{source: source, environment: environment, doc: doc, chain: chain, env: env}, nil
+}
+
+//Source returns the source given to NewLoader
+func (l *Loader) Source() interface{} {
+	return l.source
+}
+
+//Environment returns the name of the loaded environment
+func (l *Loader) Environment() string {
+	return l.environment
+}
+
+//Sources returns the sources of the configuration in merge order
+func (l *Loader) Sources() []string {
+	return l.doc.order
+}
+
+//Has reports whether the environment declares the section name
+func (l *Loader) Has(name string) bool {
+	_, ok := l.env[name]
+	return ok
+}
+
+//Section decodes the section name into target, a pointer to a config struct, sets
+//its defaults, then checks and validates it.
+func (l *Loader) Section(name string, target interface{}) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return fmt.Errorf("config: section %s needs a non-nil pointer, not %T", name, target)
+	}
+	data, err := yaml.Marshal(l.env[name])
+	if err != nil {
+		return err
+	}
+	if err = yaml.Unmarshal(data, target); err != nil {
+		err = l.doc.locate(Errors{{Key: name, Err: err}}, l.environment, l.chain)
+		log.Printf("Fatal: bad config : %v", err)
+		return err
+	}
+	if errs := Defaults(target, name); len(errs) > 0 {
+		err = l.doc.locate(errs, l.environment, l.chain)
+		log.Printf("Fatal: bad config : %v", err)
+		return err
+	}
+	if err = verify(value.Elem().Interface(), l.env[name], name); err != nil {
+		err = l.doc.locate(err.(Errors), l.environment, l.chain)
+		log.Printf("Fatal: bad config : %v", err)
+	}
+	return err
+}
+
+//Get returns the registered section name as a value of its config struct
+func (l *Loader) Get(name string) (interface{}, error) {
+	sectionsMu.RLock()
+	t, ok := sections[name]
+	sectionsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("config: unknown section %s", name)
+	}
+	value := reflect.New(t)
+	if err := l.Section(name, value.Interface()); err != nil {
+		return nil, err
+	}
+	return value.Elem().Interface(), nil
+}
+
+//Validate checks every registered section declared by the environment and reports
+//the sections that are not registered.
+func (l *Loader) Validate() error {
+	var errs Errors
+	var names []string
+	for name := range l.env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sectionsMu.RLock()
+		_, ok := sections[name]
+		sectionsMu.RUnlock()
+		if !ok {
+			errs = append(errs, &Error{Key: name, Err: errors.New("unknown section")})
+			continue
+		}
+		if _, err := l.Get(name); err != nil {
+			if e, ok := err.(Errors); ok {
+				errs = append(errs, e...)
+			} else {
+				errs = append(errs, &Error{Key: name, Err: err})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return l.doc.locate(errs, l.environment, l.chain)
+	}
+	return nil
+}
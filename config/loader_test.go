@@ -0,0 +1,113 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func init() {
+	Register("testconfig", TestConfig{})
+	Register("valid", &ValidConfig{})
+}
+
+func TestRegisterNotStruct(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Expected panic!")
+		}
+	}()
+	Register("port", 8888)
+}
+
+func TestSections(t *testing.T) {
+	names := strings.Join(Sections(), ",")
+	if !strings.Contains(names, "testconfig,valid") {
+		t.Fatalf("Must return the registered sections but %v", names)
+	}
+}
+
+func TestLoaderSection(t *testing.T) {
+	loader, err := NewLoader("config.yml", "test")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if loader.Environment() != "test" {
+		t.Fatalf("Non expected environment: %v", loader.Environment())
+	}
+	var test TestConfig
+	if err = loader.Section("testconfig", &test); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if test.Port != 8888 {
+		t.Fatalf("Non expected server port: %v != %v", 8888, test.Port)
+	}
+	i, err := loader.Get("testconfig")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if i.(TestConfig).Port != 8888 {
+		t.Fatalf("Non expected server port: %v != %v", 8888, i.(TestConfig).Port)
+	}
+	if _, err = loader.Get("unknown"); err == nil {
+		t.Fatalf("Expected error!")
+	}
+	if err = loader.Section("testconfig", test); err == nil {
+		t.Fatalf("Expected error with a non pointer target!")
+	}
+}
+
+func TestLoaderUnknownEnvironment(t *testing.T) {
+	if _, err := NewLoader("config.yml", "unknown"); err == nil {
+		t.Fatalf("Expected error!")
+	}
+}
+
+func TestLoaderValidate(t *testing.T) {
+	var data = `
+production:
+  testconfig:
+    port: 8888
+  valid:
+    port: 8888
+    hots: localhost
+  sever:
+    port: 8888
+`
+	loader, err := NewLoader([]byte(data), "production")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	err = loader.Validate()
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("Must return Errors but %v", err)
+	}
+	expected := []string{
+		"line 8: environment production: sever: unknown section",
+		"line 7: environment production: valid.hots: unknown key",
+		"line 5: environment production: valid.host: is required",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("Must return %d errors but %v", len(expected), err)
+	}
+	for i, e := range errs {
+		if e.Error() != expected[i] {
+			t.Fatalf("Must return %q but %q", expected[i], e.Error())
+		}
+	}
+}
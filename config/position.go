@@ -0,0 +1,185 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//Position of a key in a source
+type Position struct {
+	Source string
+	Line   int
+}
+
+var (
+	yamlKey  = regexp.MustCompile(`^( *)("[^"]*"|'[^']*'|[^\s#'"\-][^:#]*?|-[^\s:#][^:#]*?)\s*:(\s|$)`)
+	yamlNext = regexp.MustCompile(`[|>][-+0-9]*\s*(#.*)?$`)
+)
+
+//positions returns the line of every key path of data. Paths are the keys joined with dots.
+func positions(format Format, data []byte) map[string]int {
+	switch format {
+	case JSON:
+		return jsonPositions(data)
+	case TOML:
+		return tomlPositions(data)
+	}
+	return yamlPositions(data)
+}
+
+//yamlPositions scans the block mappings of a YAML document
+func yamlPositions(data []byte) map[string]int {
+	lines := make(map[string]int)
+	type level struct {
+		indent int
+		key    string
+	}
+	var stack []level
+	block := -1
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if block >= 0 {
+			if len(trimmed) == 0 || indent > block {
+				continue
+			}
+			block = -1
+		}
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		match := yamlKey.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, level{indent, unquote(match[2])})
+		var keys []string
+		for _, l := range stack {
+			keys = append(keys, l.key)
+		}
+		lines[strings.Join(keys, ".")] = n
+		if yamlNext.MatchString(line[len(match[0]):]) {
+			block = indent
+		}
+	}
+	return lines
+}
+
+//jsonPositions walks the tokens of a JSON document
+func jsonPositions(data []byte) map[string]int {
+	lines := make(map[string]int)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	line := func() int {
+		return bytes.Count(data[:decoder.InputOffset()], []byte("\n")) + 1
+	}
+	var walk func(path string) bool
+	walk = func(path string) bool {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		delim, ok := token.(json.Delim)
+		if !ok {
+			return true
+		}
+		for i := 0; decoder.More(); i++ {
+			child := strconv.Itoa(i)
+			if delim == '{' {
+				key, err := decoder.Token()
+				if err != nil {
+					return false
+				}
+				child = key.(string)
+			}
+			if len(path) > 0 {
+				child = path + "." + child
+			}
+			if delim == '{' {
+				lines[child] = line()
+			}
+			if !walk(child) {
+				return false
+			}
+		}
+		_, err = decoder.Token()
+		return err == nil
+	}
+	walk("")
+	return lines
+}
+
+//tomlPositions scans the tables and keys of a TOML document
+func tomlPositions(data []byte) map[string]int {
+	lines := make(map[string]int)
+	table := ""
+	multiline := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if multiline {
+			multiline = strings.Count(line, `"""`)%2 == 0 && strings.Count(line, `'''`)%2 == 0
+			continue
+		}
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if tomlTable.MatchString(line) {
+			table = tomlPath(strings.Trim(line, "[]"))
+			lines[table] = n
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			continue
+		}
+		key := tomlPath(line[:i])
+		if len(table) > 0 {
+			key = table + "." + key
+		}
+		lines[key] = n
+		value := line[i+1:]
+		multiline = strings.Count(value, `"""`)%2 == 1 || strings.Count(value, `'''`)%2 == 1
+	}
+	return lines
+}
+
+//tomlPath returns a dotted TOML key without quotes and spaces
+func tomlPath(key string) string {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		parts[i] = unquote(strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ".")
+}
+
+func unquote(key string) string {
+	key = strings.TrimSpace(key)
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') && key[len(key)-1] == key[0] {
+		return key[1 : len(key)-1]
+	}
+	return key
+}
@@ -0,0 +1,181 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Encrypted is the prefix of the encrypted values, e.g. "password: enc:v1:..."
+const Encrypted = "enc:v1:"
+
+//Environment variables giving the master key, base64 encoded, or the file containing it
+var (
+	MasterKeyEnv     = "LUNARC_MASTER_KEY"
+	MasterKeyFileEnv = "LUNARC_MASTER_KEY_FILE"
+)
+
+//KeySize is the size of a master key: AES-256
+const KeySize = 32
+
+//ErrNoMasterKey is returned when a configuration contains encrypted values without a master key
+var ErrNoMasterKey = errors.New("no master key: set " + MasterKeyEnv + " or " + MasterKeyFileEnv)
+
+//GenerateKey returns a new base64 encoded master key
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+//MasterKey returns the master key from the environment
+func MasterKey() ([]byte, error) {
+	encoded := os.Getenv(MasterKeyEnv)
+	if len(encoded) == 0 {
+		filename := os.Getenv(MasterKeyFileEnv)
+		if len(filename) == 0 {
+			return nil, ErrNoMasterKey
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(data)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("bad master key: %v", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("bad master key: %d bytes instead of %d", len(key), KeySize)
+	}
+	return key, nil
+}
+
+//Encrypt returns the encrypted value of plaintext to write in a configuration file
+func Encrypt(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return Encrypted + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+//Decrypt returns the plaintext of a value produced by Encrypt
+func Decrypt(key []byte, value string) (string, error) {
+	if !strings.HasPrefix(value, Encrypted) {
+		return "", errors.New("not an encrypted value")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(value[len(Encrypted):])
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted value too short")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("can't decrypt value: wrong master key or corrupted value")
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//decrypt replaces the encrypted values of tree and records their keys in encrypted.
+//The master key is only read when an encrypted value is found.
+func decrypt(tree map[string]interface{}, prefix string, key *[]byte, encrypted map[string]bool) (errs Errors) {
+	var names []string
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var e Errors
+		tree[name], e = decryptValue(tree[name], join(prefix, name), key, encrypted)
+		errs = append(errs, e...)
+		if len(e) > 0 && *key == nil {
+			return
+		}
+	}
+	return
+}
+
+//decryptValue returns value with its encrypted values replaced, the items of a
+//list being keyed by their index, e.g. servers.0.password
+func decryptValue(value interface{}, path string, key *[]byte, encrypted map[string]bool) (interface{}, Errors) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, decrypt(v, path, key, encrypted)
+	case []interface{}:
+		var errs Errors
+		for i, item := range v {
+			var e Errors
+			v[i], e = decryptValue(item, join(path, strconv.Itoa(i)), key, encrypted)
+			errs = append(errs, e...)
+			if len(e) > 0 && *key == nil {
+				return v, errs
+			}
+		}
+		return v, errs
+	case string:
+		if !strings.HasPrefix(v, Encrypted) {
+			return v, nil
+		}
+		if *key == nil {
+			k, err := MasterKey()
+			if err != nil {
+				return v, Errors{&Error{Key: path, Err: err}}
+			}
+			*key = k
+		}
+		plaintext, err := Decrypt(*key, v)
+		if err != nil {
+			return v, Errors{&Error{Key: path, Err: err}}
+		}
+		encrypted[path] = true
+		return scalar(plaintext), nil
+	}
+	return value, nil
+}
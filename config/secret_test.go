@@ -0,0 +1,153 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	encoded, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	key, _ := base64.StdEncoding.DecodeString(encoded)
+
+	value, err := Encrypt(key, "LunarcSecretKey")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if !strings.HasPrefix(value, Encrypted) {
+		t.Fatalf("Must start with %s but %v", Encrypted, value)
+	}
+	plaintext, err := Decrypt(key, value)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if plaintext != "LunarcSecretKey" {
+		t.Fatalf("Must return LunarcSecretKey but %v", plaintext)
+	}
+
+	other := make([]byte, KeySize)
+	if _, err = Decrypt(other, value); err == nil {
+		t.Fatalf("Expected error with a wrong key!")
+	}
+}
+
+func TestMasterKeyFile(t *testing.T) {
+	os.Setenv(MasterKeyFileEnv, "no-master.key")
+	defer os.Unsetenv(MasterKeyFileEnv)
+	if _, err := MasterKey(); err == nil {
+		t.Fatalf("Expected error!")
+	}
+}
+
+func TestMasterKeyBadSize(t *testing.T) {
+	os.Setenv(MasterKeyEnv, base64.StdEncoding.EncodeToString([]byte("short")))
+	defer os.Unsetenv(MasterKeyEnv)
+	if _, err := MasterKey(); err == nil {
+		t.Fatalf("Expected error!")
+	}
+}
+
+func TestGetWithEncryptedValue(t *testing.T) {
+	encoded, _ := GenerateKey()
+	key, _ := base64.StdEncoding.DecodeString(encoded)
+	os.Setenv(MasterKeyEnv, encoded)
+	defer os.Unsetenv(MasterKeyEnv)
+
+	level, _ := Encrypt(key, "DEBUG")
+	port, _ := Encrypt(key, "9000")
+	var data = `
+test:
+  testconfig:
+    port: ` + port + `
+    log:
+      level: ` + level + `
+production:
+  testconfig:
+    log:
+      level: enc:v1:encryptedwithanotherkey
+`
+	var testEnvironment TestEnvironment
+	i, err := Get([]byte(data), "test", &testEnvironment)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	test := i.(TestConfig)
+	if test.Port != 9000 {
+		t.Fatalf("Non expected server port: %v != %v", 9000, test.Port)
+	}
+	if test.Log.Level != "DEBUG" {
+		t.Fatalf("Non expected log level: %v != %v", "DEBUG", test.Log.Level)
+	}
+}
+
+func TestGetWithEncryptedValueWithoutKey(t *testing.T) {
+	var data = `
+test:
+  testconfig:
+    log:
+      level: enc:v1:AAAA
+`
+	var testEnvironment TestEnvironment
+	_, err := Get([]byte(data), "test", &testEnvironment)
+	if err == nil {
+		t.Fatalf("Expected error!")
+	}
+	if !strings.HasPrefix(err.Error(), "line 5: environment test: testconfig.log.level: no master key") {
+		t.Fatalf("Error must name the key: %v", err)
+	}
+}
+
+func TestDecryptList(t *testing.T) {
+	encoded, _ := GenerateKey()
+	key, _ := base64.StdEncoding.DecodeString(encoded)
+	os.Setenv(MasterKeyEnv, encoded)
+	defer os.Unsetenv(MasterKeyEnv)
+
+	token, _ := Encrypt(key, "s3cr3t")
+	password, _ := Encrypt(key, "passw0rd")
+	tree, err := parse(YAML, []byte(`
+test:
+  tokens: [public, ` + token + `]
+  servers:
+    - host: smtp1
+      password: ` + password + `
+`))
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	env := tree["test"].(map[string]interface{})
+	encrypted := make(map[string]bool)
+	var k []byte
+	if errs := decrypt(env, "", &k, encrypted); len(errs) > 0 {
+		t.Fatalf("Non expected error: %v", errs)
+	}
+	if tokens := env["tokens"].([]interface{}); tokens[0] != "public" || tokens[1] != "s3cr3t" {
+		t.Fatalf("Must decrypt the items of a list: %v", tokens)
+	}
+	server := env["servers"].([]interface{})[0].(map[string]interface{})
+	if server["password"] != "passw0rd" {
+		t.Fatalf("Must decrypt the mappings of a list: %v", server)
+	}
+	if !encrypted["tokens.1"] || !encrypted["servers.0.password"] || encrypted["tokens.0"] {
+		t.Fatalf("Non expected encrypted keys: %v", encrypted)
+	}
+}
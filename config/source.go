@@ -0,0 +1,197 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//ConfD is the name of the directory holding drop-in configuration files
+const ConfD = "conf.d"
+
+//Sources returns the layers of a configuration in merge order: the base file,
+//its per-host file (config.<hostname>.yml), its local file (config.local.yml)
+//and the conf.d directory next to it. Missing layers are skipped.
+func Sources(filename string) (sources []string) {
+	sources = []string{filename}
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	var candidates []string
+	if hostname, err := os.Hostname(); err == nil && len(hostname) > 0 {
+		candidates = append(candidates, base+"."+hostname+ext)
+	}
+	candidates = append(candidates, base+".local"+ext, filepath.Join(filepath.Dir(filename), ConfD))
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			sources = append(sources, candidate)
+		}
+	}
+	return
+}
+
+//layers returns the Sources of a filename, a directory being its own only layer
+func layers(name string) []string {
+	if info, err := os.Stat(name); err == nil && info.IsDir() {
+		return []string{name}
+	}
+	return Sources(name)
+}
+
+//Load reads and deep-merges the source. A source is a filename, read with its
+//layers (see Sources), a directory, a []byte or a []string of filenames and
+//directories read as they are. Files of a directory are
+//merged in lexical order. YAML, JSON and TOML sources can be mixed. Load returns the merged tree and the merge order.
+func Load(source interface{}) (tree map[string]interface{}, order []string, err error) {
+	doc, err := load(source)
+	return doc.tree, doc.order, err
+}
+
+//document is a merged configuration with the position of its keys
+type document struct {
+	tree      map[string]interface{}
+	order     []string
+	positions map[string]Position
+	encrypted map[string]bool
+}
+
+func load(source interface{}) (doc document, err error) {
+	doc = document{tree: make(map[string]interface{}), positions: make(map[string]Position)}
+	switch s := source.(type) {
+	case []byte:
+		err = doc.add("", s)
+		doc.order = []string{"[]byte"}
+	case string:
+		return load(layers(s))
+	case []string:
+		var files []string
+		if files, err = listFiles(s); err != nil {
+			return
+		}
+		for _, filename := range files {
+			var data []byte
+			if data, err = ioutil.ReadFile(filename); err != nil {
+				return
+			}
+			if err = doc.add(filename, data); err != nil {
+				err = fmt.Errorf("%s: %v", filename, err)
+				return
+			}
+			doc.order = append(doc.order, filename)
+		}
+	default:
+		err = fmt.Errorf("unsupported source type %T", source)
+	}
+	return
+}
+
+//add merges a source into the document
+func (doc *document) add(filename string, data []byte) error {
+	format := FormatOf(filename, data)
+	layer, err := parse(format, data)
+	if err != nil {
+		return err
+	}
+	Merge(doc.tree, layer)
+	for path, line := range positions(format, data) {
+		doc.positions[path] = Position{Source: filename, Line: line}
+	}
+	return nil
+}
+
+//locate sets the environment and the position of errs
+func (doc *document) locate(errs Errors, environment string, parents map[string]string) Errors {
+	for _, e := range errs {
+		e.Environment = environment
+		e.Position = doc.position(environment, e.Key, parents)
+	}
+	return errs
+}
+
+//position returns where key of environment is declared, following the extends chain.
+//A missing key is reported at its closest declared parent.
+func (doc *document) position(environment, key string, parents map[string]string) Position {
+	for {
+		for env, seen := environment, 0; len(env) > 0 && seen <= len(parents); env, seen = parents[env], seen+1 {
+			if p, ok := doc.positions[join(env, key)]; ok {
+				return p
+			}
+		}
+		if len(key) == 0 {
+			return Position{}
+		}
+		if i := strings.LastIndex(key, "."); i >= 0 {
+			key = key[:i]
+		} else {
+			key = ""
+		}
+	}
+}
+
+//Merge deep-merges src into dst. Mappings are merged key by key, any other
+//value of src replaces the value of dst.
+func Merge(dst, src map[string]interface{}) {
+	for key, value := range src {
+		s, ok := value.(map[string]interface{})
+		d, isMap := dst[key].(map[string]interface{})
+		if ok && isMap {
+			Merge(d, s)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+//listFiles replaces the directories of sources by the files they contain
+func listFiles(sources []string) (files []string, err error) {
+	for _, source := range sources {
+		var info os.FileInfo
+		if info, err = os.Stat(source); err != nil {
+			return
+		}
+		if !info.IsDir() {
+			files = append(files, source)
+			continue
+		}
+		var entries []os.FileInfo
+		if entries, err = ioutil.ReadDir(source); err != nil {
+			return
+		}
+		var names []string
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !supported(entry.Name()) {
+				continue
+			}
+			names = append(names, filepath.Join(source, entry.Name()))
+		}
+		sort.Strings(names)
+		files = append(files, names...)
+	}
+	return
+}
+
+//supported reports whether filename has a configuration file extension
+func supported(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yml", ".yaml", ".json", ".toml":
+		return true
+	}
+	return false
+}
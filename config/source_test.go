@@ -0,0 +1,104 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSourcesNormal(t *testing.T) {
+	sources := Sources("layers/config.yml")
+	expected := []string{"layers/config.yml", "layers/config.local.yml", filepath.Join("layers", ConfD)}
+	if !reflect.DeepEqual(sources, expected) {
+		t.Fatalf("Must return %v but %v", expected, sources)
+	}
+}
+
+func TestSourcesWithoutLayers(t *testing.T) {
+	sources := Sources("config.yml")
+	if len(sources) != 1 {
+		t.Fatalf("Must return only config.yml but %v", sources)
+	}
+}
+
+func TestLoadOrder(t *testing.T) {
+	_, order, err := Load("layers/config.yml")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	expected := []string{
+		"layers/config.yml",
+		"layers/config.local.yml",
+		filepath.Join("layers", ConfD, "10-port.yml"),
+		filepath.Join("layers", ConfD, "20-level.yml"),
+	}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("Must return %v but %v", expected, order)
+	}
+}
+
+func TestLoadNonExistentFile(t *testing.T) {
+	_, _, err := Load([]string{"config.yml", "no-config.yml"})
+	if err == nil {
+		t.Fatalf("Expected error!")
+	}
+}
+
+func TestMergeNormal(t *testing.T) {
+	dst := map[string]interface{}{
+		"server": map[string]interface{}{"port": 8888, "url": "localhost"},
+		"hosts":  []interface{}{"a", "b"},
+	}
+	src := map[string]interface{}{
+		"server": map[string]interface{}{"port": 9000},
+		"hosts":  []interface{}{"c"},
+	}
+	Merge(dst, src)
+
+	server := dst["server"].(map[string]interface{})
+	if server["port"] != 9000 || server["url"] != "localhost" {
+		t.Fatalf("Must merge server but %v", server)
+	}
+	if !reflect.DeepEqual(dst["hosts"], []interface{}{"c"}) {
+		t.Fatalf("Must replace lists but %v", dst["hosts"])
+	}
+}
+
+func TestGetWithLayers(t *testing.T) {
+	var testEnvironment TestEnvironment
+	i, err := Get(Sources("layers/config.yml"), "production", &testEnvironment)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	var fileEnvironment TestEnvironment
+	j, err := Get("layers/config.yml", "production", &fileEnvironment)
+	if err != nil || j != i {
+		t.Fatalf("A filename must be loaded with its layers: %v %v", j, err)
+	}
+	test := i.(TestConfig)
+	if test.Port != 9000 {
+		t.Fatalf("Non expected server port: %v != %v", 9000, test.Port)
+	}
+	if strings.Compare(test.Log.Level, "DEBUG") != 0 {
+		t.Fatalf("Non expected log level: %v != %v", "DEBUG", test.Log.Level)
+	}
+	if strings.Compare(test.Log.File, "./logs/") != 0 {
+		t.Fatalf("Non expected log file: %v != %v", "./logs/", test.Log.File)
+	}
+}
@@ -16,24 +16,31 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
-	"io/ioutil"
+	"fmt"
 	"log"
+	"os"
+	"reflect"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
 
 // Get a config
 func Get(source interface{}, environment string, configEnv Environment) (conf interface{}, err error) {
-	if filename, ok := source.(string); ok {
-		source, err = ioutil.ReadFile(filename)
-		if err != nil {
-			log.Printf("Fatal: %v", err)
-			return
-		}
+	doc, chain, err := prepare(source, environment)
+	if err != nil {
+		return
+	}
+
+	data, err := yaml.Marshal(doc.tree)
+	if err != nil {
+		log.Printf("Fatal: bad config : %v", err)
+		return
 	}
 
-	err = yaml.Unmarshal(source.([]byte), configEnv)
+	err = yaml.Unmarshal(data, configEnv)
 	if err != nil {
 		log.Printf("Fatal: bad config : %v", err)
 		return
@@ -41,8 +48,134 @@ func Get(source interface{}, environment string, configEnv Environment) (conf in
 
 	conf = configEnv.GetEnvironment(environment)
 	if conf == nil {
-		err = errors.New("No configuration")
+		err = fmt.Errorf("No configuration for environment %s", environment)
+		return
+	}
+
+	var prefix string
+	var section interface{}
+	if s, ok := configEnv.(Section); ok {
+		prefix = s.Section()
+		if env, ok := doc.tree[environment].(map[string]interface{}); ok {
+			section = env[prefix]
+		}
+	}
+	value := reflect.New(reflect.TypeOf(conf))
+	value.Elem().Set(reflect.ValueOf(conf))
+	if errs := Defaults(value.Interface(), prefix); len(errs) > 0 {
+		err = doc.locate(errs, environment, chain)
+		log.Printf("Fatal: bad config : %v", err)
 		return
 	}
+	conf = value.Elem().Interface()
+
+	err = verify(conf, section, prefix)
+	if err != nil {
+		err = doc.locate(err.(Errors), environment, chain)
+		log.Printf("Fatal: bad config : %v", err)
+	}
 	return
 }
+
+//prepare loads source and resolves the inheritance, the variables, the overrides
+//and the encrypted values of environment.
+func prepare(source interface{}, environment string) (doc document, chain map[string]string, err error) {
+	doc, err = load(source)
+	if err != nil {
+		log.Printf("Fatal: %v", err)
+		return
+	}
+	if len(doc.order) > 1 {
+		log.Printf("Config: merged %s", strings.Join(doc.order, ", "))
+	}
+
+	tree := doc.tree
+	chain = parents(tree)
+	if err = InheritEnvironment(tree, environment); err != nil {
+		log.Printf("Fatal: bad config : %v", err)
+		return
+	}
+	Interpolate(tree)
+	Override(tree, environment, os.Environ())
+	if env, ok := tree[environment].(map[string]interface{}); ok {
+		var key []byte
+		doc.encrypted = make(map[string]bool)
+		if errs := decrypt(env, "", &key, doc.encrypted); len(errs) > 0 {
+			err = doc.locate(errs, environment, chain)
+			log.Printf("Fatal: bad config : %v", err)
+			return
+		}
+	}
+	return
+}
+
+//verify reports the unknown keys of section and the invalid values of conf.
+//section is the tree conf was decoded from, or nil.
+func verify(conf interface{}, section interface{}, prefix string) error {
+	var errs Errors
+	if section != nil {
+		for _, key := range Unknown(section, reflect.TypeOf(conf), prefix) {
+			errs = append(errs, &Error{Key: key, Err: errors.New("unknown key")})
+		}
+	}
+	errs = append(errs, Validate(conf, prefix)...)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+//parse returns the generic tree of a document
+func parse(format Format, data []byte) (tree map[string]interface{}, err error) {
+	raw, err := decode(format, data)
+	if err != nil {
+		return
+	}
+	if raw == nil {
+		return make(map[string]interface{}), nil
+	}
+	tree, ok := normalize(raw).(map[string]interface{})
+	if !ok {
+		err = errors.New("the document root must be a mapping of environments")
+	}
+	return
+}
+
+//normalize converts the maps produced by the decoders into map[string]interface{}
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			m[fmt.Sprint(key)] = normalize(child)
+		}
+		return m
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = normalize(child)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = normalize(child)
+		}
+		return v
+	case []map[string]interface{}:
+		l := make([]interface{}, len(v))
+		for i, child := range v {
+			l[i] = normalize(child)
+		}
+		return l
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return normalize(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case int64:
+		if int64(int(v)) == v {
+			return int(v)
+		}
+	}
+	return value
+}
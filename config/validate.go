@@ -0,0 +1,327 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//Validator checks a non-zero value against the parameter of its rule,
+//e.g. 65535 for max=65535.
+type Validator func(value interface{}, param string) error
+
+var (
+	validatorsMu sync.RWMutex
+	validators   = map[string]Validator{
+		"min":  minimum,
+		"max":  maximum,
+		"file": file,
+		"dir":  dir,
+	}
+)
+
+//RegisterValidator makes a rule available in the validate tag of config structs.
+//"required" is built in and checks that the value is not zero.
+func RegisterValidator(name string, validator Validator) {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	validators[name] = validator
+}
+
+//Error is a problem found at a key of an environment
+type Error struct {
+	Environment string
+	Key         string
+	Position    Position
+	Err         error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("environment %s: %s: %v", e.Environment, e.Key, e.Err)
+	switch {
+	case e.Position.Line > 0 && len(e.Position.Source) > 0:
+		return fmt.Sprintf("%s:%d: %s", e.Position.Source, e.Position.Line, msg)
+	case e.Position.Line > 0:
+		return fmt.Sprintf("line %d: %s", e.Position.Line, msg)
+	}
+	return msg
+}
+
+//Errors lists every problem found in a configuration
+type Errors []*Error
+
+func (e Errors) Error() string {
+	var msgs []string
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+//Validate checks the rules declared in the validate tags of conf, e.g.
+//`validate:"required,min=1,max=65535"`. Keys are reported from prefix.
+func Validate(conf interface{}, prefix string) (errs Errors) {
+	validate(reflect.ValueOf(conf), prefix, "", &errs)
+	return
+}
+
+func validate(value reflect.Value, path string, tag string, errs *Errors) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			break
+		}
+		value = value.Elem()
+	}
+	if len(tag) > 0 {
+		for _, err := range check(value, tag) {
+			*errs = append(*errs, &Error{Key: path, Err: err})
+		}
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		t := value.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, inline, ok := keyOf(field)
+			if !ok {
+				continue
+			}
+			child := join(path, name)
+			if inline {
+				child = path
+			}
+			validate(value.Field(i), child, field.Tag.Get("validate"), errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			validate(value.Index(i), join(path, strconv.Itoa(i)), "", errs)
+		}
+	}
+}
+
+//check applies the rules of tag to value
+func check(value reflect.Value, tag string) (errs []error) {
+	rules := strings.Split(tag, ",")
+	zero := !value.IsValid() || isZero(value)
+	for _, rule := range rules {
+		if rule == "required" && zero {
+			return []error{errors.New("is required")}
+		}
+	}
+	if zero {
+		return
+	}
+	validatorsMu.RLock()
+	defer validatorsMu.RUnlock()
+	for _, rule := range rules {
+		name, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+		if name == "required" || len(name) == 0 {
+			continue
+		}
+		validator, ok := validators[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown validation rule %s", name))
+			continue
+		}
+		if err := validator(value.Interface(), param); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return
+}
+
+//Unknown returns the keys of tree that do not match a field of the struct type t
+func Unknown(tree interface{}, t reflect.Type, prefix string) (keys []string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := tree.(map[string]interface{})
+		if !ok {
+			return
+		}
+		var names []string
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			field, ok := fieldOf(t, name)
+			if !ok {
+				keys = append(keys, join(prefix, name))
+				continue
+			}
+			keys = append(keys, Unknown(m[name], field.Type, join(prefix, name))...)
+		}
+	case reflect.Slice, reflect.Array:
+		l, ok := tree.([]interface{})
+		if !ok {
+			return
+		}
+		for i, child := range l {
+			keys = append(keys, Unknown(child, t.Elem(), join(prefix, strconv.Itoa(i)))...)
+		}
+	}
+	return
+}
+
+//fieldOf returns the field of t read from the key name, looking into inline fields
+func fieldOf(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, inline, ok := keyOf(field)
+		if !ok {
+			continue
+		}
+		if inline {
+			if f, ok := fieldOf(field.Type, name); ok {
+				return f, true
+			}
+			continue
+		}
+		if key == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+//keyOf returns the key of a field the way the YAML decoder reads it
+func keyOf(field reflect.StructField) (key string, inline bool, ok bool) {
+	if len(field.PkgPath) > 0 && !field.Anonymous {
+		return
+	}
+	tag := field.Tag.Get("yaml")
+	if tag == "-" {
+		return
+	}
+	parts := strings.Split(tag, ",")
+	for _, flag := range parts[1:] {
+		if flag == "inline" {
+			return "", true, true
+		}
+	}
+	key = parts[0]
+	if len(key) == 0 {
+		key = strings.ToLower(field.Name)
+	}
+	return key, false, true
+}
+
+func join(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
+
+func isZero(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	case reflect.Struct:
+		return reflect.DeepEqual(value.Interface(), reflect.Zero(value.Type()).Interface())
+	case reflect.Ptr, reflect.Interface, reflect.Func, reflect.Chan:
+		return value.IsNil()
+	}
+	return value.Interface() == reflect.Zero(value.Type()).Interface()
+}
+
+func number(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String, reflect.Slice, reflect.Map:
+		return float64(v.Len()), true
+	}
+	return 0, false
+}
+
+func minimum(value interface{}, param string) error {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return fmt.Errorf("bad min rule %q", param)
+	}
+	if n, ok := number(value); ok && n < limit {
+		return fmt.Errorf("must be at least %s", param)
+	}
+	return nil
+}
+
+func maximum(value interface{}, param string) error {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return fmt.Errorf("bad max rule %q", param)
+	}
+	if n, ok := number(value); ok && n > limit {
+		return fmt.Errorf("must be at most %s", param)
+	}
+	return nil
+}
+
+func file(value interface{}, param string) error {
+	if filenames, ok := value.([]string); ok {
+		for _, filename := range filenames {
+			if err := file(filename, param); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	filename, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return fmt.Errorf("file %s does not exist", filename)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", filename)
+	}
+	return nil
+}
+
+func dir(value interface{}, param string) error {
+	dirname, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	info, err := os.Stat(dirname)
+	if err != nil {
+		return fmt.Errorf("directory %s does not exist", dirname)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dirname)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//ValidConfig
+type ValidConfig struct {
+	Port int    `validate:"required,min=1,max=65535"`
+	Host string `validate:"required"`
+	SSL  struct {
+		Certificate string `validate:"file"`
+	}
+	Mode string `validate:"mode"`
+	Log  struct {
+		Level string
+	}
+}
+
+//ValidEnvironment configurations
+type ValidEnvironment struct {
+	Env map[string]ValidConfig
+}
+
+//UnmarshalYAML implements Unmarshaler.
+func (ve *ValidEnvironment) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var aux map[string]struct {
+		ValidConfig ValidConfig `yaml:"valid"`
+	}
+	if err := unmarshal(&aux); err != nil {
+		return err
+	}
+	ve.Env = make(map[string]ValidConfig)
+	for env, conf := range aux {
+		ve.Env[env] = conf.ValidConfig
+	}
+	return nil
+}
+
+//Section returns valid
+func (ve *ValidEnvironment) Section() string {
+	return "valid"
+}
+
+//GetEnvironment returns a ValidConfig
+func (ve *ValidEnvironment) GetEnvironment(environment string) interface{} {
+	if conf, ok := ve.Env[environment]; ok {
+		return conf
+	}
+	return nil
+}
+
+func init() {
+	RegisterValidator("mode", func(value interface{}, param string) error {
+		if value != "fast" && value != "slow" {
+			return errors.New("must be fast or slow")
+		}
+		return nil
+	})
+}
+
+func TestValidateNormal(t *testing.T) {
+	var conf ValidConfig
+	conf.Port = 8888
+	conf.Host = "localhost"
+	conf.SSL.Certificate = "ssl/test.crt"
+	conf.Mode = "fast"
+	if errs := Validate(conf, "valid"); len(errs) != 0 {
+		t.Fatalf("Non expected error: %v", errs)
+	}
+}
+
+func TestValidateFiles(t *testing.T) {
+	var conf struct {
+		CA []string `validate:"file"`
+	}
+	conf.CA = []string{"ssl/test.crt", "ssl/unknown.crt"}
+	errs := Validate(conf, "valid")
+	if len(errs) != 1 || !strings.Contains(errs.Error(), "ssl/unknown.crt") {
+		t.Fatalf("Must report ssl/unknown.crt but %v", errs)
+	}
+}
+
+func TestValidateDir(t *testing.T) {
+	var conf struct {
+		Root   string `validate:"dir"`
+		Public string `validate:"dir"`
+	}
+	conf.Root, conf.Public = "ssl", "ssl/test.crt"
+	errs := Validate(conf, "valid")
+	if len(errs) != 1 || errs[0].Key != "valid.public" {
+		t.Fatalf("Must report valid.public but %v", errs)
+	}
+}
+
+func TestValidateAllErrors(t *testing.T) {
+	var conf ValidConfig
+	conf.Port = 70000
+	conf.SSL.Certificate = "ssl/NoCert.crt"
+	conf.Mode = "medium"
+	errs := Validate(conf, "valid")
+	var keys []string
+	for _, err := range errs {
+		keys = append(keys, err.Key)
+	}
+	expected := []string{"valid.port", "valid.host", "valid.ssl.certificate", "valid.mode"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("Must return %v but %v", expected, errs)
+	}
+}
+
+func TestUnknownNormal(t *testing.T) {
+	tree := map[string]interface{}{
+		"prot": 8888,
+		"host": "localhost",
+		"log":  map[string]interface{}{"levl": "DEBUG"},
+	}
+	keys := Unknown(tree, reflect.TypeOf(ValidConfig{}), "valid")
+	expected := []string{"valid.log.levl", "valid.prot"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("Must return %v but %v", expected, keys)
+	}
+}
+
+func TestGetWithErrors(t *testing.T) {
+	var data = `
+production:
+  valid:
+    port: 8888
+    host: localhost
+    mode: fast
+staging:
+  extends: production
+  valid:
+    prot: 9000
+    mode: medium
+    log:
+      levl: DEBUG
+`
+	var validEnvironment ValidEnvironment
+	_, err := Get([]byte(data), "staging", &validEnvironment)
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("Must return Errors but %v", err)
+	}
+	expected := []string{
+		"line 13: environment staging: valid.log.levl: unknown key",
+		"line 10: environment staging: valid.prot: unknown key",
+		"line 11: environment staging: valid.mode: must be fast or slow",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("Must return %d errors but %v", len(expected), err)
+	}
+	for i, e := range errs {
+		if e.Error() != expected[i] {
+			t.Fatalf("Must return %q but %q", expected[i], e.Error())
+		}
+	}
+}
+
+func TestGetWithInheritedError(t *testing.T) {
+	var data = `
+production:
+  valid:
+    port: 70000
+    host: localhost
+staging:
+  extends: production
+`
+	var validEnvironment ValidEnvironment
+	_, err := Get([]byte(data), "staging", &validEnvironment)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 4: environment staging: valid.port") {
+		t.Fatalf("Must report the line of the parent environment but %v", err)
+	}
+}
+
+func TestGetWithUnknownEnvironment(t *testing.T) {
+	var validEnvironment ValidEnvironment
+	_, err := Get([]byte("production:\n  valid:\n    port: 8888\n"), "staging", &validEnvironment)
+	if err == nil || !strings.Contains(err.Error(), "staging") {
+		t.Fatalf("Error must name the environment: %v", err)
+	}
+}
+
+func TestPositions(t *testing.T) {
+	var tests = []struct {
+		format Format
+		data   string
+		lines  map[string]int
+	}{
+		{YAML, "# comment\nproduction:\n  server:\n    port: 8888\n    description: |\n      port: 1\n    url: \"http://localhost\"\n",
+			map[string]int{"production": 2, "production.server": 3, "production.server.port": 4, "production.server.url": 7}},
+		{JSON, "{\n  \"production\": {\n    \"server\": {\"port\": 8888,\n      \"url\": \"localhost\"}\n  }\n}",
+			map[string]int{"production": 2, "production.server": 3, "production.server.port": 3, "production.server.url": 4}},
+		{TOML, "[production.server]\nport = 8888\n\n[production.server.log]\nlevel = \"DEBUG\"\n",
+			map[string]int{"production.server": 1, "production.server.port": 2, "production.server.log.level": 5}},
+	}
+	for _, test := range tests {
+		lines := positions(test.format, []byte(test.data))
+		for path, line := range test.lines {
+			if lines[path] != line {
+				t.Fatalf("%v: %s must be at line %d but %d", test.format, path, line, lines[path])
+			}
+		}
+		if _, ok := lines["production.server.description.port"]; ok {
+			t.Fatalf("Must ignore block scalars: %v", lines)
+		}
+	}
+}
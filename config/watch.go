@@ -0,0 +1,175 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+//Interval between two checks of the watched sources
+var Interval = 2 * time.Second
+
+//Subscriber is notified with the old and the new configuration of an environment
+type Subscriber func(old, new interface{})
+
+//Watcher re-reads a configuration when one of its sources changes and notifies
+//its subscribers. An invalid configuration is logged and the current one is kept.
+type Watcher struct {
+	source      []string
+	environment string
+	configEnv   Environment
+	reload      sync.Mutex
+	mu          sync.Mutex
+	current     interface{}
+	stamps      map[string]string
+	subscribers []Subscriber
+	quit        chan bool
+	done        chan bool
+}
+
+//NewWatcher loads the configuration of environment from the files and directories
+//of source. configEnv is reused for every reload.
+func NewWatcher(source interface{}, environment string, configEnv Environment) (w *Watcher, err error) {
+	var files []string
+	switch s := source.(type) {
+	case string:
+		files = layers(s)
+	case []string:
+		files = s
+	default:
+		err = fmt.Errorf("can't watch a source of type %T", source)
+		return
+	}
+	w = &Watcher{source: files, environment: environment, configEnv: configEnv}
+	w.stamps, err = w.stat()
+	if err != nil {
+		return nil, err
+	}
+	w.current, err = Get(files, environment, configEnv)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+//Current returns the current configuration
+func (w *Watcher) Current() interface{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+//Subscribe registers a subscriber called after every change of the configuration
+func (w *Watcher) Subscribe(subscriber Subscriber) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, subscriber)
+}
+
+//Start checks the sources every Interval until Stop is called
+func (w *Watcher) Start() {
+	w.mu.Lock()
+	if w.quit != nil {
+		w.mu.Unlock()
+		return
+	}
+	w.quit = make(chan bool)
+	w.done = make(chan bool)
+	quit, done := w.quit, w.done
+	w.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(Interval)
+		defer ticker.Stop()
+		defer close(done)
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				stamps, err := w.stat()
+				if err != nil {
+					log.Printf("Config: can't watch %v: %v", w.source, err)
+					continue
+				}
+				if reflect.DeepEqual(stamps, w.stamps) {
+					continue
+				}
+				w.stamps = stamps
+				if err := w.Reload(); err != nil {
+					log.Printf("Config: reload failed, the current configuration is kept: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+//Stop the watcher
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	quit, done := w.quit, w.done
+	w.quit, w.done = nil, nil
+	w.mu.Unlock()
+	if quit != nil {
+		close(quit)
+		<-done
+	}
+}
+
+//Reload re-reads the configuration and notifies the subscribers when it changed
+func (w *Watcher) Reload() error {
+	w.reload.Lock()
+	defer w.reload.Unlock()
+	conf, err := Get(w.source, w.environment, w.configEnv)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	old := w.current
+	w.current = conf
+	subscribers := append([]Subscriber(nil), w.subscribers...)
+	w.mu.Unlock()
+	if reflect.DeepEqual(old, conf) {
+		return nil
+	}
+	log.Printf("Config: environment %s reloaded", w.environment)
+	for _, subscriber := range subscribers {
+		subscriber(old, conf)
+	}
+	return nil
+}
+
+//stat returns the modification time and size of every watched file
+func (w *Watcher) stat() (stamps map[string]string, err error) {
+	files, err := listFiles(w.source)
+	if err != nil {
+		return
+	}
+	stamps = make(map[string]string, len(files))
+	for _, filename := range files {
+		var info os.FileInfo
+		if info, err = os.Stat(filename); err != nil {
+			return
+		}
+		stamps[filename] = fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+	}
+	return
+}
@@ -0,0 +1,108 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, filename string, port string) {
+	data := "test:\n  testconfig:\n    port: " + port + "\n"
+	if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatalf("Error during test preparation : %v", err)
+	}
+}
+
+func TestWatcherNormal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lunarc")
+	if err != nil {
+		t.Fatalf("Error during test preparation : %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "config.yml")
+	writeConfig(t, filename, "8888")
+
+	interval := Interval
+	Interval = 10 * time.Millisecond
+	defer func() { Interval = interval }()
+
+	var testEnvironment TestEnvironment
+	w, err := NewWatcher(filename, "test", &testEnvironment)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if w.Current().(TestConfig).Port != 8888 {
+		t.Fatalf("Non expected server port: %v", w.Current())
+	}
+
+	changes := make(chan [2]int, 1)
+	w.Subscribe(func(old, new interface{}) {
+		changes <- [2]int{old.(TestConfig).Port, new.(TestConfig).Port}
+	})
+	w.Start()
+	defer w.Stop()
+
+	writeConfig(t, filename, "99999")
+
+	select {
+	case change := <-changes:
+		if change != [2]int{8888, 99999} {
+			t.Fatalf("Must notify 8888 -> 99999 but %v", change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Subscriber not notified")
+	}
+	if w.Current().(TestConfig).Port != 99999 {
+		t.Fatalf("Non expected server port: %v", w.Current())
+	}
+}
+
+func TestWatcherKeepsConfigurationOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lunarc")
+	if err != nil {
+		t.Fatalf("Error during test preparation : %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "config.yml")
+	writeConfig(t, filename, "8888")
+
+	var testEnvironment TestEnvironment
+	w, err := NewWatcher(filename, "test", &testEnvironment)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	notified := false
+	w.Subscribe(func(old, new interface{}) { notified = true })
+
+	writeConfig(t, filename, "[8888")
+	if err := w.Reload(); err == nil {
+		t.Fatalf("Expected error!")
+	}
+	if notified || w.Current().(TestConfig).Port != 8888 {
+		t.Fatalf("Must keep the current configuration: %v", w.Current())
+	}
+}
+
+func TestWatcherWithByteSource(t *testing.T) {
+	var testEnvironment TestEnvironment
+	if _, err := NewWatcher([]byte("test:\n"), "test", &testEnvironment); err == nil {
+		t.Fatalf("Expected error!")
+	}
+}
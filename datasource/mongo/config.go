@@ -17,17 +17,23 @@ package mongo
 
 import (
 	"strings"
+	"time"
 
 	"github.com/DamienFontaine/lunarc/config"
 )
 
+func init() {
+	config.Register("mongo", Config{})
+}
+
 //Config of Mongo
 type Config struct {
-	Port     int
-	Host     string
-	Database string
+	Port     int    `default:"27017" validate:"max=65535"`
+	Host     string `validate:"required"`
+	Database string `validate:"required"`
 	Username string
-	Password string
+	Password string        `secret:"true"`
+	Timeout  time.Duration `default:"10s"`
 }
 
 //Environment configurations
@@ -52,6 +58,11 @@ func (m *Environment) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
+//Section returns the key of the Mongo configuration in an environment
+func (m *Environment) Section() string {
+	return "mongo"
+}
+
 //GetEnvironment returns a Mongo configuration for the specified environment in parameter
 func (m *Environment) GetEnvironment(environment string) interface{} {
 	for env, conf := range m.Env {
@@ -64,8 +75,10 @@ func (m *Environment) GetEnvironment(environment string) interface{} {
 
 //GetMongo returns a Mongo configurations
 func GetMongo(source interface{}, environment string) (mongo Config, err error) {
-	var env Environment
-	i, err := config.Get(source, environment, &env)
-	mongo = i.(Config)
+	loader, err := config.NewLoader(source, environment)
+	if err != nil {
+		return
+	}
+	err = loader.Section("mongo", &mongo)
 	return
 }
@@ -18,6 +18,7 @@ package mongo
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/DamienFontaine/lunarc/config"
 
@@ -124,3 +125,22 @@ func TestGetMongoNormal(t *testing.T) {
 		t.Fatalf("Must return a Mongo with password credential lunarc not %v", mongo.Password)
 	}
 }
+
+func TestGetMongoDefaults(t *testing.T) {
+	var data = `
+  development:
+    mongo:
+      host: mongo
+      database: test
+  `
+	mongo, err := GetMongo([]byte(data), "development")
+	if err != nil {
+		t.Fatalf("Non expected error %v", err)
+	}
+	if mongo.Port != 27017 {
+		t.Fatalf("Must return a Mongo with the default Port 27017 not %v", mongo.Port)
+	}
+	if mongo.Timeout != 10*time.Second {
+		t.Fatalf("Must return a Mongo with the default Timeout 10s not %v", mongo.Timeout)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+package mongo
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/DamienFontaine/lunarc/metrics"
+	"github.com/mongodb/mongo-go-driver/core/event"
+	"github.com/mongodb/mongo-go-driver/mongo/clientopt"
+)
+
+var (
+	mongoConnections     = metrics.NewGauge("lunarc_mongo_pool_connections", "Number of open connections of the Mongo pools.")
+	mongoDials           = metrics.NewCounter("lunarc_mongo_pool_dials_total", "Number of connections opened by the Mongo pools.")
+	mongoDialFailures    = metrics.NewCounter("lunarc_mongo_pool_dial_failures_total", "Number of connections the Mongo pools failed to open.")
+	mongoCommandsRunning = metrics.NewGauge("lunarc_mongo_commands_in_flight", "Number of Mongo commands holding a connection.")
+	mongoCommandLatency  = metrics.NewHistogram("lunarc_mongo_command_duration_seconds", "Latency of the Mongo commands.", nil, "command")
+	mongoCommandFailures = metrics.NewCounter("lunarc_mongo_command_failures_total", "Number of failed Mongo commands.", "command")
+)
+
+func init() {
+	metrics.MustRegister(mongoConnections, mongoDials, mongoDialFailures, mongoCommandsRunning, mongoCommandLatency, mongoCommandFailures)
+}
+
+//instrumented returns the client options exporting the state of the connection
+//pools: the driver has no pool statistics, the connections are counted when they
+//are dialed and closed and the commands while they hold a connection.
+func instrumented() []clientopt.Option {
+	return []clientopt.Option{
+		clientopt.Dialer(&countingDialer{dialer: &net.Dialer{}}),
+		clientopt.Monitor(commandMonitor),
+	}
+}
+
+//commandMonitor measures the commands of the Mongo clients
+var commandMonitor = &event.CommandMonitor{
+	Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+		mongoCommandsRunning.Inc()
+	},
+	Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+		mongoCommandsRunning.Dec()
+		mongoCommandLatency.Observe(time.Duration(e.DurationNanos).Seconds(), e.CommandName)
+	},
+	Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+		mongoCommandsRunning.Dec()
+		mongoCommandLatency.Observe(time.Duration(e.DurationNanos).Seconds(), e.CommandName)
+		mongoCommandFailures.Inc(e.CommandName)
+	},
+}
+
+//countingDialer counts the connections it opens until they are closed
+type countingDialer struct {
+	dialer clientopt.ContextDialer
+}
+
+//DialContext dials a connection counted until its first Close
+func (d *countingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.dialer.DialContext(ctx, network, address)
+	if err != nil {
+		mongoDialFailures.Inc()
+		return nil, err
+	}
+	mongoDials.Inc()
+	mongoConnections.Inc()
+	return &countedConn{Conn: conn}, nil
+}
+
+//countedConn is a connection of a Mongo pool
+type countedConn struct {
+	net.Conn
+	closed sync.Once
+}
+
+//Close closes the connection and uncounts it
+func (c *countedConn) Close() error {
+	c.closed.Do(func() { mongoConnections.Dec() })
+	return c.Conn.Close()
+}
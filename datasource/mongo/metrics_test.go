@@ -0,0 +1,76 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/DamienFontaine/lunarc/metrics"
+	"github.com/mongodb/mongo-go-driver/core/event"
+)
+
+//exported returns the metrics in the Prometheus text format
+func exported(t *testing.T) string {
+	var b bytes.Buffer
+	if _, err := metrics.DefaultRegistry.WriteTo(&b); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	return b.String()
+}
+
+func TestPoolMetrics(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	defer l.Close()
+	d := &countingDialer{dialer: &net.Dialer{}}
+	conn, err := d.DialContext(context.Background(), "tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if _, err := d.DialContext(context.Background(), "tcp", "127.0.0.1:1"); err == nil {
+		t.Fatalf("Must fail to dial a closed port")
+	}
+	if out := exported(t); !strings.Contains(out, "lunarc_mongo_pool_connections 1\n") || !strings.Contains(out, "lunarc_mongo_pool_dial_failures_total 1\n") {
+		t.Fatalf("Must count the open connection and the failed dial:\n%s", out)
+	}
+	conn.Close()
+	conn.Close()
+	if out := exported(t); !strings.Contains(out, "lunarc_mongo_pool_connections 0\n") || !strings.Contains(out, "lunarc_mongo_pool_dials_total 1\n") {
+		t.Fatalf("Must uncount a closed connection once:\n%s", out)
+	}
+
+	ctx := context.Background()
+	commandMonitor.Started(ctx, &event.CommandStartedEvent{CommandName: "find"})
+	if out := exported(t); !strings.Contains(out, "lunarc_mongo_commands_in_flight 1\n") {
+		t.Fatalf("Must count the running command:\n%s", out)
+	}
+	commandMonitor.Failed(ctx, &event.CommandFailedEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", DurationNanos: 1e6}})
+	out := exported(t)
+	for _, expected := range []string{
+		"lunarc_mongo_commands_in_flight 0\n",
+		`lunarc_mongo_command_failures_total{command="find"} 1` + "\n",
+		`lunarc_mongo_command_duration_seconds_count{command="find"} 1` + "\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("Must expose %s:\n%s", expected, out)
+		}
+	}
+}
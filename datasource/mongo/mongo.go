@@ -19,24 +19,47 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
+	"github.com/DamienFontaine/lunarc/config"
+	"github.com/DamienFontaine/lunarc/metrics"
 	"github.com/mongodb/mongo-go-driver/mongo"
 )
 
+var (
+	mongoConnected    = metrics.NewGauge("lunarc_mongo_connected", "Number of connected Mongo clients.")
+	mongoPingLatency  = metrics.NewHistogram("lunarc_mongo_ping_duration_seconds", "Latency of the Mongo pings.", nil)
+	mongoPingFailures = metrics.NewCounter("lunarc_mongo_ping_failures_total", "Number of failed Mongo pings.")
+)
+
+func init() {
+	metrics.MustRegister(mongoConnected, mongoPingLatency, mongoPingFailures)
+}
+
 //Mongo is a datasource.
 type Mongo struct {
 	Client   *mongo.Client
 	Database *mongo.Database
 	context  context.Context
+	timeout  time.Duration
 }
 
 //NewMongo creates a newinstance of Mongo
 func NewMongo(filename string, environment string) (*Mongo, error) {
-	ctx := context.Background()
-	cnf, err := GetMongo(filename, environment)
+	loader, err := config.NewLoader(filename, environment)
 	if err != nil {
 		return nil, err
 	}
+	return NewMongoFromLoader(loader)
+}
+
+//NewMongoFromLoader creates a new instance of Mongo from the mongo section of a loaded configuration
+func NewMongoFromLoader(loader *config.Loader) (*Mongo, error) {
+	ctx := context.Background()
+	var cnf Config
+	if err := loader.Section("mongo", &cnf); err != nil {
+		return nil, err
+	}
 	var uri string
 	if len(cnf.Username) > 0 && len(cnf.Password) > 0 {
 		uri = fmt.Sprintf(`mongodb://%s:%s@%s:%d/%s`,
@@ -53,7 +76,7 @@ func NewMongo(filename string, environment string) (*Mongo, error) {
 			cnf.Database,
 		)
 	}
-	client, err := mongo.NewClient(uri)
+	client, err := mongo.NewClientWithOptions(uri, instrumented()...)
 	if err != nil {
 		log.Printf("L'URI du serveur MongoDB est incorrect: %s", uri)
 		return nil, err
@@ -66,12 +89,31 @@ func NewMongo(filename string, environment string) (*Mongo, error) {
 
 	db := client.Database(cnf.Database)
 
-	err = client.Ping(ctx, nil)
+	m := &Mongo{Client: client, Database: db, context: ctx, timeout: cnf.Timeout}
+	err = m.Ping(ctx)
 	if err != nil {
 		log.Printf("Impossible de contacter %v sur le port %d", cnf.Host, cnf.Port)
 		return nil, err
 	}
-	return &Mongo{Client: client, Database: db, context: ctx}, nil
+	mongoConnected.Inc()
+	return m, nil
+}
+
+//Ping checks that the server answers within mongo.timeout. The latency and the
+//failures are exported by metrics.
+func (m *Mongo) Ping(ctx context.Context) error {
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := m.Client.Ping(ctx, nil)
+	mongoPingLatency.Observe(time.Since(start).Seconds())
+	if err != nil {
+		mongoPingFailures.Inc()
+	}
+	return err
 }
 
 //Disconnect a Mongo client
@@ -81,5 +123,6 @@ func (m *Mongo) Disconnect() error {
 		log.Printf("Impossible de fermer la connexion")
 		return err
 	}
+	mongoConnected.Dec()
 	return nil
 }
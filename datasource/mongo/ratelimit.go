@@ -0,0 +1,125 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/DamienFontaine/lunarc/ratelimit"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/mongo"
+)
+
+//RateStore keeps the buckets of the rate limiters in a collection, shared by the
+//instances of a server. A bucket is updated only if nobody updated it since it was
+//read, and expires once full.
+type RateStore struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+type rateBucket struct {
+	Tokens  float64   `bson:"tokens"`
+	Updated int64     `bson:"updated"`
+	Expires time.Time `bson:"expires"`
+}
+
+//NewRateStore returns a RateStore using the collection name, e.g. ratelimits,
+//with a TTL index dropping the expired buckets
+func NewRateStore(m *Mongo, name string) (*RateStore, error) {
+	collection := m.Database.Collection(name)
+	ctx := context.Background()
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.NewDocument(bson.EC.Int32("expires", 1)),
+		Options: mongo.NewIndexOptionsBuilder().ExpireAfterSeconds(0).Build(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RateStore{collection: collection, timeout: m.timeout}, nil
+}
+
+//Take takes a token from the bucket of key
+func (s *RateStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	for i := 0; i < 5; i++ {
+		var stored rateBucket
+		err := s.collection.FindOne(ctx, bson.NewDocument(bson.EC.String("_id", key))).Decode(&stored)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return ratelimit.Result{}, err
+		}
+		found := err == nil
+		var bucket ratelimit.Bucket
+		if found {
+			bucket = ratelimit.Bucket{Tokens: stored.Tokens, Updated: time.Unix(0, stored.Updated)}
+		}
+		now := time.Now()
+		bucket, result := bucket.Take(now, limit)
+		if !result.Allowed {
+			return result, nil
+		}
+		expires := now.Add(result.Reset).UnixNano() / int64(time.Millisecond)
+		if !found {
+			_, err = s.collection.InsertOne(ctx, bson.NewDocument(
+				bson.EC.String("_id", key),
+				bson.EC.Double("tokens", bucket.Tokens),
+				bson.EC.Int64("updated", bucket.Updated.UnixNano()),
+				bson.EC.DateTime("expires", expires),
+			))
+			if duplicate(err) {
+				continue
+			}
+			return result, err
+		}
+		updated, err := s.collection.UpdateOne(ctx,
+			bson.NewDocument(bson.EC.String("_id", key), bson.EC.Int64("updated", stored.Updated)),
+			bson.NewDocument(bson.EC.SubDocumentFromElements("$set",
+				bson.EC.Double("tokens", bucket.Tokens),
+				bson.EC.Int64("updated", bucket.Updated.UnixNano()),
+				bson.EC.DateTime("expires", expires),
+			)))
+		if err != nil {
+			return ratelimit.Result{}, err
+		}
+		if updated.MatchedCount == 1 {
+			return result, nil
+		}
+	}
+	return ratelimit.Result{}, errors.New("too many concurrent updates of " + key)
+}
+
+//duplicate tells whether err is a duplicate key error
+func duplicate(err error) bool {
+	if errs, ok := err.(mongo.WriteErrors); ok {
+		for _, e := range errs {
+			if e.Code == 11000 {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+// +build integration
+
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DamienFontaine/lunarc/ratelimit"
+	"github.com/mongodb/mongo-go-driver/bson"
+)
+
+func TestRateStore(t *testing.T) {
+	m, err := NewMongo("config.yml", "staging")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	defer m.Disconnect()
+	store, err := NewRateStore(m, "ratelimits")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	ctx := context.Background()
+	key := "test:" + time.Now().String()
+	defer store.collection.DeleteOne(ctx, bson.NewDocument(bson.EC.String("_id", key)))
+
+	limit := ratelimit.Limit{Requests: 2, Period: time.Minute}
+	for i := 0; i < 2; i++ {
+		if result, err := store.Take(ctx, key, limit); err != nil || !result.Allowed || result.Remaining != 1-i {
+			t.Fatalf("Request %d must pass: %v %v", i, result, err)
+		}
+	}
+	result, err := store.Take(ctx, key, limit)
+	if err != nil || result.Allowed || result.RetryAfter <= 0 {
+		t.Fatalf("Must be limited: %v %v", result, err)
+	}
+
+	other, err := NewRateStore(m, "ratelimits")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if result, _ := other.Take(ctx, key, limit); result.Allowed {
+		t.Fatalf("The buckets must be shared by the stores")
+	}
+	var _ ratelimit.Store = store
+}
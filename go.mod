@@ -1,24 +1,31 @@
 module github.com/DamienFontaine/lunarc
 
+go 1.24
+
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/Sirupsen/logrus v0.11.5
-	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/andybalholm/brotli v1.2.0
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
-	github.com/go-stack/stack v1.8.0 // indirect
 	github.com/golang/mock v1.1.1
+	github.com/mongodb/mongo-go-driver v0.0.17
+	golang.org/x/crypto v0.0.0-20181106171534-e4dc69e5b2fd
+	gopkg.in/square/go-jose.v2 v2.1.9
+	gopkg.in/yaml.v2 v2.2.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/go-stack/stack v1.8.0 // indirect
 	github.com/golang/snappy v0.0.0-20180518054509-2e65f85255db // indirect
 	github.com/google/go-cmp v0.2.0 // indirect
-	github.com/mongodb/mongo-go-driver v0.0.17
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/testify v1.2.2 // indirect
 	github.com/tidwall/pretty v0.0.0-20180105212114-65a9db5fad51 // indirect
 	github.com/xdg/scram v0.0.0-20180814205039-7eeb5667e42c // indirect
 	github.com/xdg/stringprep v1.0.0 // indirect
-	golang.org/x/crypto v0.0.0-20181106171534-e4dc69e5b2fd
-	golang.org/x/net v0.0.0-20181108082009-03003ca0c849
+	golang.org/x/net v0.0.0-20181108082009-03003ca0c849 // indirect
 	golang.org/x/sync v0.0.0-20181108010431-42b317875d0f // indirect
 	golang.org/x/sys v0.0.0-20181107165924-66b7b1311ac8 // indirect
 	golang.org/x/text v0.3.0 // indirect
-	gopkg.in/square/go-jose.v2 v2.1.9
-	gopkg.in/yaml.v2 v2.2.1
 )
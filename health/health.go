@@ -0,0 +1,222 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+//Package health answers the liveness and readiness probes of a server with the
+//results of the checks registered by its components, e.g.
+//
+//	s.Health.AddReadiness(health.Check{Name: "mongo", Check: m.Ping})
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//DefaultTimeout is the timeout of a check without Timeout
+var DefaultTimeout = 5 * time.Second
+
+//Status of a Health or of a check
+type Status string
+
+//Statuses
+const (
+	Starting Status = "starting"
+	Ready    Status = "ok"
+	Stopping Status = "stopping"
+	Failed   Status = "fail"
+)
+
+//Check is a check of a component. Its result is cached during Cache.
+type Check struct {
+	Name    string
+	Check   func(context.Context) error
+	Timeout time.Duration
+	Cache   time.Duration
+}
+
+//Result of a check
+type Result struct {
+	Status   Status    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Duration string    `json:"duration"`
+	Time     time.Time `json:"time"`
+}
+
+//Report is the answer of a probe
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+//Health runs the checks of the probes. Its status is Starting until SetStatus
+//tells otherwise: the readiness probe fails while it is not Ready.
+type Health struct {
+	mu        sync.RWMutex
+	status    Status
+	liveness  []*check
+	readiness []*check
+}
+
+type check struct {
+	Check
+	mu     sync.Mutex
+	result Result
+	expiry time.Time
+}
+
+//New allocates and returns a new Health
+func New() *Health {
+	return &Health{status: Starting}
+}
+
+//SetStatus sets the status of the server, e.g. Ready once it serves
+func (h *Health) SetStatus(status Status) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status = status
+}
+
+//Status returns the status of the server
+func (h *Health) Status() Status {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.status
+}
+
+//AddLiveness adds checks to the liveness probe. A failure means the process must
+//be restarted.
+func (h *Health) AddLiveness(checks ...Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness = append(h.liveness, newChecks(checks)...)
+}
+
+//AddReadiness adds checks to the readiness probe. A failure means the server must
+//not get traffic for now, e.g. when its database is down.
+func (h *Health) AddReadiness(checks ...Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness = append(h.readiness, newChecks(checks)...)
+}
+
+func newChecks(checks []Check) []*check {
+	var c []*check
+	for _, ch := range checks {
+		if ch.Check == nil {
+			panic("health: nil check " + ch.Name)
+		}
+		c = append(c, &check{Check: ch})
+	}
+	return c
+}
+
+//Live runs the checks of the liveness probe
+func (h *Health) Live(ctx context.Context) Report {
+	h.mu.RLock()
+	checks := h.liveness
+	h.mu.RUnlock()
+	return run(ctx, checks, Ready)
+}
+
+//Ready runs the checks of the readiness probe. The report has the status of the
+//server when it is starting or stopping.
+func (h *Health) Ready(ctx context.Context) Report {
+	h.mu.RLock()
+	checks, status := h.readiness, h.status
+	h.mu.RUnlock()
+	return run(ctx, checks, status)
+}
+
+//Liveness returns the handler of the liveness probe, e.g. /healthz
+func (h *Health) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		write(w, h.Live(r.Context()))
+	})
+}
+
+//Readiness returns the handler of the readiness probe, e.g. /readyz
+func (h *Health) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		write(w, h.Ready(r.Context()))
+	})
+}
+
+//run runs the checks concurrently
+func run(ctx context.Context, checks []*check, status Status) Report {
+	report := Report{Status: status, Checks: make(map[string]Result)}
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			results[i] = c.run(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+	for i, c := range checks {
+		report.Checks[c.Name] = results[i]
+		if results[i].Status != Ready && report.Status == Ready {
+			report.Status = Failed
+		}
+	}
+	return report
+}
+
+//run returns the cached result or runs the check
+func (c *check) run(ctx context.Context) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().Before(c.expiry) {
+		return c.result
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Check.Check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = errors.New("timeout after " + timeout.String())
+	}
+	c.result = Result{Status: Ready, Duration: time.Since(start).String(), Time: start}
+	if err != nil {
+		c.result.Status, c.result.Error = Failed, err.Error()
+	}
+	c.expiry = start.Add(c.Cache)
+	return c.result
+}
+
+func write(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
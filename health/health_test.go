@@ -0,0 +1,100 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func probe(t *testing.T, h http.Handler) (int, Report) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	var report Report
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	return w.Code, report
+}
+
+func TestReadiness(t *testing.T) {
+	h := New()
+	var down bool
+	h.AddReadiness(Check{Name: "mongo", Check: func(ctx context.Context) error {
+		if down {
+			return errors.New("connection refused")
+		}
+		return nil
+	}})
+
+	if code, report := probe(t, h.Readiness()); code != http.StatusServiceUnavailable || report.Status != Starting {
+		t.Fatalf("Must not be ready while starting: %v %v", code, report.Status)
+	}
+	h.SetStatus(Ready)
+	if code, report := probe(t, h.Readiness()); code != http.StatusOK || report.Checks["mongo"].Status != Ready {
+		t.Fatalf("Must be ready: %v %v", code, report)
+	}
+	down = true
+	code, report := probe(t, h.Readiness())
+	if code != http.StatusServiceUnavailable || report.Status != Failed || report.Checks["mongo"].Error != "connection refused" {
+		t.Fatalf("Must fail with mongo: %v %v", code, report)
+	}
+	if code, _ := probe(t, h.Liveness()); code != http.StatusOK {
+		t.Fatalf("Readiness checks must not fail the liveness: %v", code)
+	}
+	h.SetStatus(Stopping)
+	if _, report := probe(t, h.Readiness()); report.Status != Stopping {
+		t.Fatalf("Must be stopping: %v", report.Status)
+	}
+}
+
+func TestCheckCacheAndTimeout(t *testing.T) {
+	h := New()
+	var calls int
+	h.AddLiveness(Check{Name: "cached", Cache: time.Minute, Check: func(ctx context.Context) error {
+		calls++
+		return nil
+	}}, Check{Name: "slow", Timeout: 10 * time.Millisecond, Check: func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}})
+
+	start := time.Now()
+	h.Live(context.Background())
+	report := h.Live(context.Background())
+	if calls != 1 {
+		t.Fatalf("The result must be cached: %d calls", calls)
+	}
+	if report.Checks["slow"].Status != Failed || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("The slow check must time out: %v", report.Checks["slow"])
+	}
+}
+
+func TestDiskSpace(t *testing.T) {
+	if err := DiskSpace(os.TempDir(), 1)(context.Background()); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if err := DiskSpace(os.TempDir(), math.MaxUint64)(context.Background()); err == nil {
+		t.Fatalf("Expected error!")
+	}
+}
@@ -0,0 +1,387 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+//Package metrics exposes counters, gauges and histograms in the Prometheus text
+//format, e.g. mux.Handle("GET /metrics", metrics.Handler()).
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//DefBuckets are the default buckets of a latency histogram, in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+//Collector writes metric families in the Prometheus text format
+type Collector interface {
+	Name() string
+	Collect(w io.Writer) error
+}
+
+//Registry is a set of collectors
+type Registry struct {
+	mu         sync.RWMutex
+	collectors map[string]Collector
+}
+
+//DefaultRegistry is the registry of Register and Handler. The HTTP, Mongo, SMTP
+//and Go runtime metrics are registered there.
+var DefaultRegistry = NewRegistry()
+
+//NewRegistry allocates and returns a new Registry
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+//Register adds collectors to the registry. Their names must be unique.
+func (r *Registry) Register(collectors ...Collector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range collectors {
+		if _, ok := r.collectors[c.Name()]; ok {
+			return fmt.Errorf("metrics: %s is already registered", c.Name())
+		}
+	}
+	for _, c := range collectors {
+		r.collectors[c.Name()] = c
+	}
+	return nil
+}
+
+//MustRegister adds collectors to the registry and panics on error
+func (r *Registry) MustRegister(collectors ...Collector) {
+	if err := r.Register(collectors...); err != nil {
+		panic(err)
+	}
+}
+
+//WriteTo writes the metrics of the registry, sorted by name
+func (r *Registry) WriteTo(w io.Writer) (n int64, err error) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	collectors := make([]Collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.mu.RUnlock()
+
+	cw := &countWriter{w: w}
+	for _, c := range collectors {
+		if err = c.Collect(cw); err != nil {
+			break
+		}
+	}
+	return cw.n, err
+}
+
+//ServeHTTP writes the metrics of the registry
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	b := bufio.NewWriter(w)
+	r.WriteTo(b)
+	b.Flush()
+}
+
+//Register adds collectors to the DefaultRegistry
+func Register(collectors ...Collector) error {
+	return DefaultRegistry.Register(collectors...)
+}
+
+//MustRegister adds collectors to the DefaultRegistry and panics on error
+func MustRegister(collectors ...Collector) {
+	DefaultRegistry.MustRegister(collectors...)
+}
+
+//Handler serves the metrics of the DefaultRegistry
+func Handler() http.Handler {
+	return DefaultRegistry
+}
+
+//family is a metric and its series, one by combination of label values
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values  []string
+	value   float64
+	buckets []uint64
+	count   uint64
+}
+
+func newFamily(name, help, kind string, labels []string) *family {
+	return &family{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*series)}
+}
+
+//Name returns the name of the metric
+func (f *family) Name() string {
+	return f.name
+}
+
+//with returns the series of values, f.mu being held. It panics when the number
+//of values is not the number of labels.
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels but %d values", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		f.series[key] = s
+	}
+	return s
+}
+
+//sorted returns the keys of the series
+func (f *family) sorted() []string {
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *family) header(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.kind)
+	return err
+}
+
+//Collect writes the series of a counter or a gauge
+func (f *family) Collect(w io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.header(w); err != nil {
+		return err
+	}
+	for _, key := range f.sorted() {
+		s := f.series[key]
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", f.name, labels(f.labels, s.values), format(s.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Counter is a metric which only goes up, e.g. the number of requests
+type Counter struct {
+	*family
+}
+
+//NewCounter returns a counter whose series are labelled by labels
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{newFamily(name, help, "counter", labels)}
+}
+
+//Inc adds 1 to the series of values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+//Add adds v to the series of values. It panics when v is negative.
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic("metrics: counter " + c.name + " cannot decrease")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.with(values).value += v
+}
+
+//Gauge is a metric which goes up and down, e.g. the requests in flight
+type Gauge struct {
+	*family
+}
+
+//NewGauge returns a gauge whose series are labelled by labels
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{newFamily(name, help, "gauge", labels)}
+}
+
+//Set sets the series of values to v
+func (g *Gauge) Set(v float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.with(values).value = v
+}
+
+//Add adds v to the series of values
+func (g *Gauge) Add(v float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.with(values).value += v
+}
+
+//Inc adds 1 to the series of values
+func (g *Gauge) Inc(values ...string) {
+	g.Add(1, values...)
+}
+
+//Dec subtracts 1 from the series of values
+func (g *Gauge) Dec(values ...string) {
+	g.Add(-1, values...)
+}
+
+//Histogram counts observations in buckets, e.g. the latency of the requests
+type Histogram struct {
+	*family
+	buckets []float64
+}
+
+//NewHistogram returns a histogram whose series are labelled by labels. The
+//buckets are the upper bounds of the buckets, DefBuckets when nil.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{newFamily(name, help, "histogram", labels), buckets}
+}
+
+//Observe adds v to the series of values
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.with(values)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.buckets))
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.buckets[i]++
+	}
+	s.value += v
+	s.count++
+}
+
+//Collect writes the buckets, the sum and the count of the series
+func (h *Histogram) Collect(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.header(w); err != nil {
+		return err
+	}
+	names := append(append([]string(nil), h.labels...), "le")
+	for _, key := range h.sorted() {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.buckets[i]
+			values := append(append([]string(nil), s.values...), format(bound))
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels(names, values), cumulative); err != nil {
+				return err
+			}
+		}
+		values := append(append([]string(nil), s.values...), "+Inf")
+		_, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.name, labels(names, values), s.count,
+			h.name, labels(h.labels, s.values), format(s.value),
+			h.name, labels(h.labels, s.values), s.count)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Func is a metric without labels read when it is collected, e.g. the number of goroutines
+type Func struct {
+	name, help, kind string
+	f                func() float64
+}
+
+//NewGaugeFunc returns a gauge whose value is f()
+func NewGaugeFunc(name, help string, f func() float64) *Func {
+	return &Func{name, help, "gauge", f}
+}
+
+//NewCounterFunc returns a counter whose value is f()
+func NewCounterFunc(name, help string, f func() float64) *Func {
+	return &Func{name, help, "counter", f}
+}
+
+//Name returns the name of the metric
+func (m *Func) Name() string {
+	return m.name
+}
+
+//Collect writes the value of the metric
+func (m *Func) Collect(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", m.name, escapeHelp(m.help), m.name, m.kind, m.name, format(m.f()))
+	return err
+}
+
+func labels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeValue(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func format(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var valueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeValue(s string) string {
+	return valueReplacer.Replace(s)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
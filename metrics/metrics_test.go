@@ -0,0 +1,99 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	registry := NewRegistry()
+	requests := NewCounter("requests_total", "Number of requests.", "method", "code")
+	inFlight := NewGauge("in_flight", "Requests\nin flight.")
+	registry.MustRegister(requests, inFlight)
+
+	requests.Inc("GET", "200")
+	requests.Add(2, "GET", "200")
+	requests.Inc("POST", `"bad"`)
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+
+	var out bytes.Buffer
+	if _, err := registry.WriteTo(&out); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	expected := `# HELP in_flight Requests\nin flight.
+# TYPE in_flight gauge
+in_flight 1
+# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{method="GET",code="200"} 3
+requests_total{method="POST",code="\"bad\""} 1
+`
+	if out.String() != expected {
+		t.Fatalf("Non expected output:\n%s", out.String())
+	}
+
+	if err := registry.Register(NewGauge("in_flight", "")); err == nil {
+		t.Fatalf("Expected error!")
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	latency := NewHistogram("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+	latency.Observe(0.05, "/users")
+	latency.Observe(0.1, "/users")
+	latency.Observe(0.5, "/users")
+	latency.Observe(2, "/users")
+
+	var out bytes.Buffer
+	latency.Collect(&out)
+	expected := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/users",le="0.1"} 2
+latency_seconds_bucket{route="/users",le="1"} 3
+latency_seconds_bucket{route="/users",le="+Inf"} 4
+latency_seconds_sum{route="/users"} 2.65
+latency_seconds_count{route="/users"} 4
+`
+	if out.String() != expected {
+		t.Fatalf("Non expected output:\n%s", out.String())
+	}
+}
+
+func TestLabelValues(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Expected panic!")
+		}
+	}()
+	NewCounter("requests_total", "", "method").Inc()
+}
+
+func TestHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("Non expected content type: %v", w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "\ngo_goroutines ") {
+		t.Fatalf("Must expose the runtime metrics: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package metrics
+
+import (
+	"io"
+	"runtime"
+	"time"
+)
+
+func init() {
+	MustRegister(NewRuntimeCollector())
+}
+
+//runtimeCollector writes the Go runtime statistics
+type runtimeCollector struct {
+	start time.Time
+}
+
+//NewRuntimeCollector returns a collector of the goroutines, memory and garbage
+//collections of the Go runtime. It is registered in the DefaultRegistry.
+func NewRuntimeCollector() Collector {
+	return &runtimeCollector{start: time.Now()}
+}
+
+//Name returns the prefix of the metrics
+func (c *runtimeCollector) Name() string {
+	return "go"
+}
+
+//Collect reads the statistics of the runtime
+func (c *runtimeCollector) Collect(w io.Writer) error {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	for _, m := range []*Func{
+		NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() float64 { return float64(runtime.NumGoroutine()) }),
+		NewGaugeFunc("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", func() float64 { return float64(stats.Alloc) }),
+		NewCounterFunc("go_memstats_alloc_bytes_total", "Total number of bytes allocated, even if freed.", func() float64 { return float64(stats.TotalAlloc) }),
+		NewGaugeFunc("go_memstats_heap_objects", "Number of allocated objects.", func() float64 { return float64(stats.HeapObjects) }),
+		NewGaugeFunc("go_memstats_sys_bytes", "Number of bytes obtained from system.", func() float64 { return float64(stats.Sys) }),
+		NewCounterFunc("go_gc_cycles_total", "Number of completed GC cycles.", func() float64 { return float64(stats.NumGC) }),
+		NewCounterFunc("go_gc_pause_seconds_total", "Total time the GC stopped the world.", func() float64 { return float64(stats.PauseTotalNs) / 1e9 }),
+		NewGaugeFunc("process_uptime_seconds", "Time since the process started.", func() float64 { return time.Since(c.start).Seconds() }),
+	} {
+		if err := m.Collect(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
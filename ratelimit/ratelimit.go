@@ -0,0 +1,128 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+//Package ratelimit has the token buckets of the rate limiters and the stores
+//keeping them, e.g. web.RateLimiter with a MemoryStore.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+//Limit is a token bucket of Burst tokens, Requests by default, refilled with
+//Requests tokens every Period, 1s by default. Each request takes a token from the
+//bucket of its Key: ip, the client IP, header:NAME, e.g. header:X-Api-Key, or
+//subject, the subject of its JWT, see security.RateLimiter.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+	Key      string
+}
+
+//Size returns the number of tokens of a full bucket
+func (l Limit) Size() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+//Interval returns the time to get a token back
+func (l Limit) Interval() time.Duration {
+	period := l.Period
+	if period <= 0 {
+		period = time.Second
+	}
+	return period / time.Duration(l.Requests)
+}
+
+//Result is the state of a bucket after a request
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+//Bucket is the state of a token bucket, kept by a Store
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+//Take refills the bucket up to now and takes a token if there is one
+func (b Bucket) Take(now time.Time, limit Limit) (Bucket, Result) {
+	size, interval := float64(limit.Size()), limit.Interval()
+	if b.Updated.IsZero() {
+		b.Tokens = size
+	} else if elapsed := now.Sub(b.Updated); elapsed > 0 {
+		b.Tokens = math.Min(size, b.Tokens+float64(elapsed)/float64(interval))
+	}
+	b.Updated = now
+	var result Result
+	if b.Tokens >= 1 {
+		b.Tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.Tokens) * float64(interval))
+	}
+	result.Remaining = int(b.Tokens)
+	result.Reset = time.Duration((size - b.Tokens) * float64(interval))
+	return b, result
+}
+
+//Store keeps the buckets of the rate limiters
+type Store interface {
+	//Take takes a token from the bucket of key
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+//MemoryStore keeps the buckets in memory, for a single instance. The full buckets
+//are dropped from time to time.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]Bucket
+	resets  map[string]time.Time
+	swept   time.Time
+}
+
+//NewMemoryStore allocates and returns a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]Bucket), resets: make(map[string]time.Time), swept: time.Now()}
+}
+
+//Take takes a token from the bucket of key
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.swept) > time.Minute {
+		for k, reset := range s.resets {
+			if now.After(reset) {
+				delete(s.buckets, k)
+				delete(s.resets, k)
+			}
+		}
+		s.swept = now
+	}
+	bucket, result := s.buckets[key].Take(now, limit)
+	s.buckets[key] = bucket
+	s.resets[key] = now.Add(result.Reset)
+	return result, nil
+}
@@ -0,0 +1,58 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	limit := Limit{Requests: 10, Period: time.Second, Burst: 2}
+	now := time.Now()
+	var bucket Bucket
+	var result Result
+	for i := 0; i < 3; i++ {
+		bucket, result = bucket.Take(now, limit)
+	}
+	if result.Allowed || result.RetryAfter != 100*time.Millisecond {
+		t.Fatalf("The bucket must be empty: %v", result)
+	}
+	bucket, result = bucket.Take(now.Add(150*time.Millisecond), limit)
+	if !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("The bucket must be refilled: %v", result)
+	}
+	bucket, result = bucket.Take(now.Add(time.Hour), limit)
+	if !result.Allowed || result.Remaining != 1 {
+		t.Fatalf("The bucket must hold at most its burst: %v", result)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 1, Period: time.Hour}
+	ctx := context.Background()
+	if result, _ := store.Take(ctx, "auth:192.168.1.10", limit); !result.Allowed {
+		t.Fatalf("Must pass: %v", result)
+	}
+	if result, _ := store.Take(ctx, "auth:192.168.1.10", limit); result.Allowed {
+		t.Fatalf("Must be limited: %v", result)
+	}
+	if result, _ := store.Take(ctx, "auth:192.168.1.11", limit); !result.Allowed {
+		t.Fatalf("Another key must have its own bucket: %v", result)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package security
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+
+	"github.com/DamienFontaine/lunarc/web"
+)
+
+type identityKey struct{}
+
+//Identity of a client authenticated by its TLS certificate
+type Identity struct {
+	Name        string
+	Subject     string
+	DNSNames    []string
+	URIs        []string
+	Emails      []string
+	Certificate *x509.Certificate
+}
+
+//NewIdentity returns the identity of a certificate. Its name is the common name
+//of the subject, or else its first URI, DNS name or email SAN.
+func NewIdentity(certificate *x509.Certificate) *Identity {
+	identity := &Identity{
+		Subject:     certificate.Subject.String(),
+		DNSNames:    certificate.DNSNames,
+		Emails:      certificate.EmailAddresses,
+		Certificate: certificate,
+	}
+	for _, uri := range certificate.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+	}
+	for _, names := range [][]string{{certificate.Subject.CommonName}, identity.URIs, identity.DNSNames, identity.Emails} {
+		if len(names) > 0 && len(names[0]) > 0 {
+			identity.Name = names[0]
+			break
+		}
+	}
+	return identity
+}
+
+//names returns the names matched by server.ssl.client.allow
+func (i *Identity) names() []string {
+	names := []string{i.Name, i.Subject}
+	names = append(names, i.DNSNames...)
+	names = append(names, i.URIs...)
+	return append(names, i.Emails...)
+}
+
+//IdentityOf returns the identity of the client certificate of a request, nil
+//when it was not authenticated by CertificateHandler.
+func IdentityOf(r *http.Request) *Identity {
+	identity, _ := r.Context().Value(identityKey{}).(*Identity)
+	return identity
+}
+
+//CertificateHandler authenticates the requests by the client certificate verified
+//by the TLS listener, see server.ssl.client, and puts its Identity in the context.
+//A request without certificate gets a 401, unless server.ssl.client.auth is
+//optional, and a certificate whose names are not in server.ssl.client.allow, when
+//given, gets a 403.
+func CertificateHandler(next http.Handler, cnf web.Config) http.Handler {
+	allowed := make(map[string]bool)
+	for _, name := range cnf.SSL.Client.Allow {
+		allowed[name] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			if cnf.SSL.Client.Auth == "optional" {
+				next.ServeHTTP(w, r)
+			} else {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+			return
+		}
+		identity := NewIdentity(r.TLS.VerifiedChains[0][0])
+		if len(allowed) > 0 && !allows(allowed, identity) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		web.SetUser(r, identity.Name)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, identity)))
+	})
+}
+
+func allows(allowed map[string]bool, identity *Identity) bool {
+	for _, name := range identity.names() {
+		if allowed[name] {
+			return true
+		}
+	}
+	return false
+}
+
+//CertificateMiddleware returns CertificateHandler as a middleware, e.g.
+//mux.Use(security.CertificateMiddleware(cnf))
+func CertificateMiddleware(cnf web.Config) web.Middleware {
+	return func(next http.Handler) http.Handler {
+		return CertificateHandler(next, cnf)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DamienFontaine/lunarc/web"
+)
+
+func certificateRequest(certificate *x509.Certificate) *http.Request {
+	r := httptest.NewRequest("GET", "/orders", nil)
+	r.TLS = &tls.ConnectionState{}
+	if certificate != nil {
+		r.TLS.VerifiedChains = [][]*x509.Certificate{{certificate}}
+	}
+	return r
+}
+
+func TestCertificateHandler(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://lunarc.io/billing")
+	certificate := &x509.Certificate{Subject: pkix.Name{Organization: []string{"Lunarc"}}, URIs: []*url.URL{spiffe}, DNSNames: []string{"billing.lunarc.io"}}
+	var identity *Identity
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity = IdentityOf(r)
+	})
+
+	var cnf web.Config
+	w := httptest.NewRecorder()
+	CertificateHandler(next, cnf).ServeHTTP(w, certificateRequest(certificate))
+	if w.Code != http.StatusOK || identity == nil {
+		t.Fatalf("Must authenticate the client: %v", w.Code)
+	}
+	if identity.Name != "spiffe://lunarc.io/billing" || identity.Subject != "O=Lunarc" {
+		t.Fatalf("Non expected identity: %+v", identity)
+	}
+
+	w = httptest.NewRecorder()
+	CertificateHandler(next, cnf).ServeHTTP(w, certificateRequest(nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("A request without certificate must get a 401 but %v", w.Code)
+	}
+	cnf.SSL.Client.Auth = "optional"
+	identity = nil
+	w = httptest.NewRecorder()
+	CertificateHandler(next, cnf).ServeHTTP(w, certificateRequest(nil))
+	if w.Code != http.StatusOK || identity != nil {
+		t.Fatalf("An optional certificate must let the request through: %v %v", w.Code, identity)
+	}
+
+	cnf.SSL.Client.Allow = []string{"orders.lunarc.io"}
+	w = httptest.NewRecorder()
+	CertificateHandler(next, cnf).ServeHTTP(w, certificateRequest(certificate))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("A certificate not allowed must get a 403 but %v", w.Code)
+	}
+	cnf.SSL.Client.Allow = []string{"billing.lunarc.io"}
+	w = httptest.NewRecorder()
+	CertificateHandler(next, cnf).ServeHTTP(w, certificateRequest(certificate))
+	if w.Code != http.StatusOK {
+		t.Fatalf("An allowed certificate must get a 200 but %v", w.Code)
+	}
+}
+
+func TestTokenHandlerWithCertificate(t *testing.T) {
+	var cnf web.Config
+	cnf.Jwt.Key = "LunarcSecretKey"
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	certificate := &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}
+	h := web.Chain(next, CertificateMiddleware(cnf), TokenMiddleware(cnf))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, certificateRequest(certificate))
+	if w.Code != http.StatusOK {
+		t.Fatalf("A client certificate must replace the token: %v", w.Code)
+	}
+}
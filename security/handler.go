@@ -19,22 +19,23 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/DamienFontaine/lunarc/ratelimit"
 	"github.com/DamienFontaine/lunarc/web"
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/dgrijalva/jwt-go/request"
 )
 
-//TokenHandler manage authorizations
+//TokenHandler manage authorizations. A request authenticated by CertificateHandler
+//needs no token.
 func TokenHandler(next http.Handler, cnf web.Config) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, err := request.ParseFromRequest(r, request.AuthorizationHeaderExtractor, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				//TODO: On ne passe jamais à l'intérieur
-				return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(cnf.Jwt.Key), nil
-		})
+		if IdentityOf(r) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, err := parseToken(r, cnf)
 		if err == nil && token.Valid {
+			setUser(r, token)
 			next.ServeHTTP(w, r)
 		} else {
 			if r.URL.String() == "/" {
@@ -46,19 +47,78 @@ func TokenHandler(next http.Handler, cnf web.Config) http.Handler {
 	})
 }
 
-//Oauth2 manage authorizations
+//Oauth2 manage authorizations. A request authenticated by CertificateHandler
+//needs no token.
 func Oauth2(next http.Handler, cnf web.Config) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, err := request.ParseFromRequest(r, request.AuthorizationHeaderExtractor, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(cnf.Jwt.Key), nil
-		})
+		if IdentityOf(r) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, err := parseToken(r, cnf)
 		if err == nil && token.Valid {
+			setUser(r, token)
 			next.ServeHTTP(w, r)
 		} else {
 			w.WriteHeader(http.StatusUnauthorized)
 		}
 	})
 }
+
+//parseToken parses the JWT of the Authorization header, signed with server.jwt.key
+func parseToken(r *http.Request, cnf web.Config) (*jwt.Token, error) {
+	return request.ParseFromRequest(r, request.AuthorizationHeaderExtractor, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			//TODO: On ne passe jamais à l'intérieur
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(cnf.Jwt.Key), nil
+	})
+}
+
+//setUser names the user of the token, its username or subject, in the access log
+func setUser(r *http.Request, token *jwt.Token) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return
+	}
+	for _, claim := range []string{"username", "sub"} {
+		if name, ok := claims[claim].(string); ok && len(name) > 0 {
+			web.SetUser(r, name)
+			return
+		}
+	}
+}
+
+//TokenMiddleware returns TokenHandler as a middleware, e.g. mux.Use(security.TokenMiddleware(cnf))
+func TokenMiddleware(cnf web.Config) web.Middleware {
+	return func(next http.Handler) http.Handler {
+		return TokenHandler(next, cnf)
+	}
+}
+
+//Oauth2Middleware returns Oauth2 as a middleware
+func Oauth2Middleware(cnf web.Config) web.Middleware {
+	return func(next http.Handler) http.Handler {
+		return Oauth2(next, cnf)
+	}
+}
+
+//RateLimiter returns web.RateLimiter keyed by the subject of the JWT of a request
+//when limit.Key is subject. A request without a valid token is keyed by its IP.
+func RateLimiter(name string, limit ratelimit.Limit, store ratelimit.Store, cnf web.Config) web.Middleware {
+	if limit.Key != "subject" {
+		return web.RateLimiter(name, limit, store, nil)
+	}
+	return web.RateLimiter(name, limit, store, func(r *http.Request) string {
+		token, err := parseToken(r, cnf)
+		if err == nil && token.Valid {
+			if claims, ok := token.Claims.(jwt.MapClaims); ok {
+				if sub, ok := claims["sub"].(string); ok && len(sub) > 0 {
+					return "sub:" + sub
+				}
+			}
+		}
+		return web.ClientIP(r)
+	})
+}
@@ -23,7 +23,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/DamienFontaine/lunarc/ratelimit"
 	"github.com/DamienFontaine/lunarc/web"
+	"github.com/Sirupsen/logrus/hooks/test"
 	jwt "github.com/dgrijalva/jwt-go"
 )
 
@@ -141,3 +143,107 @@ func TestOAuth2WithGoodToken(t *testing.T) {
 		t.Fatalf("Non expected code: %v", w.Code)
 	}
 }
+
+func TestTokenMiddleware(t *testing.T) {
+	cnf := new(web.Config)
+	mux := web.NewRouter()
+	api := mux.Group("/api", TokenMiddleware(*cnf))
+	api.Handle("POST /robot.txt", web.SingleFile("robot.txt"))
+	mux.With(Oauth2Middleware(*cnf)).Handle("POST /oauth2/robot.txt", web.SingleFile("robot.txt"))
+	mux.Handle("POST /robot.txt", web.SingleFile("robot.txt"))
+
+	for target, code := range map[string]int{
+		"/api/robot.txt":    http.StatusUnauthorized,
+		"/oauth2/robot.txt": http.StatusUnauthorized,
+		"/robot.txt":        http.StatusOK,
+	} {
+		request, _ := http.NewRequest("POST", target, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, request)
+		if w.Code != code {
+			t.Fatalf("Non expected code for %s: %v", target, w.Code)
+		}
+	}
+}
+
+func TestTokenHandlerLogsUser(t *testing.T) {
+	cnf := new(web.Config)
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	claims := token.Claims.(jwt.MapClaims)
+	claims["username"] = "test"
+	claims["exp"] = time.Now().Add(time.Minute * 10).Unix()
+	tokenString, _ := token.SignedString([]byte(cnf.Jwt.Key))
+
+	request, _ := http.NewRequest("POST", "/robot.txt", nil)
+	request.Header.Set("Authorization", "bearer "+tokenString)
+
+	logger, hook := test.NewNullLogger()
+	w := httptest.NewRecorder()
+	web.Logging(TokenHandler(web.SingleFile("robot.txt"), *cnf), logger).ServeHTTP(w, request)
+
+	if user := hook.LastEntry().Data["user"]; user != "test" {
+		t.Fatalf("Must log the user of the token but %v", user)
+	}
+}
+
+func TestRateLimiterSubject(t *testing.T) {
+	cnf := new(web.Config)
+	signed := func(sub string) string {
+		token := jwt.New(jwt.GetSigningMethod("HS256"))
+		claims := token.Claims.(jwt.MapClaims)
+		claims["sub"] = sub
+		claims["exp"] = time.Now().Add(time.Minute * 10).Unix()
+		tokenString, _ := token.SignedString([]byte(cnf.Jwt.Key))
+		return tokenString
+	}
+	h := RateLimiter("api", ratelimit.Limit{Requests: 1, Period: time.Minute, Key: "subject"}, ratelimit.NewMemoryStore(), *cnf)(web.SingleFile("robot.txt"))
+	code := func(token, ip string) int {
+		request, _ := http.NewRequest("POST", "/robot.txt", nil)
+		request.RemoteAddr = ip + ":53412"
+		if len(token) > 0 {
+			request.Header.Set("Authorization", "bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, request)
+		return w.Code
+	}
+
+	if c := code(signed("alice"), "192.168.1.10"); c != http.StatusOK {
+		t.Fatalf("Non expected code: %v", c)
+	}
+	if c := code(signed("alice"), "192.168.1.11"); c != http.StatusTooManyRequests {
+		t.Fatalf("A subject must be limited from any IP: %v", c)
+	}
+	if c := code(signed("bob"), "192.168.1.10"); c != http.StatusOK {
+		t.Fatalf("Another subject must have its own bucket: %v", c)
+	}
+	code("", "192.168.1.12")
+	if c := code("forged", "192.168.1.12"); c != http.StatusTooManyRequests {
+		t.Fatalf("A request without a valid token must be limited by IP: %v", c)
+	}
+}
+
+func TestTokenMiddlewarePreflight(t *testing.T) {
+	cnf := web.Config{CORS: web.CORS{Origins: []string{"https://app.lunarc.io"}}}
+	mux := web.NewLoggingServeMux(cnf)
+	mux.Use(TokenMiddleware(cnf))
+	mux.Handle("GET /api/users", web.SingleFile("robot.txt"))
+
+	request, _ := http.NewRequest("OPTIONS", "/api/users", nil)
+	request.Header.Set("Origin", "https://app.lunarc.io")
+	request.Header.Set("Access-Control-Request-Method", "GET")
+	request.Header.Set("Access-Control-Request-Headers", "Authorization")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, request)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://app.lunarc.io" {
+		t.Fatalf("The preflight must be answered before the token: %v %v", w.Code, w.Header())
+	}
+
+	request, _ = http.NewRequest("GET", "/api/users", nil)
+	request.Header.Set("Origin", "https://app.lunarc.io")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, request)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("Access-Control-Allow-Origin") != "https://app.lunarc.io" {
+		t.Fatalf("The request must need a token: %v %v", w.Code, w.Header())
+	}
+}
@@ -21,14 +21,18 @@ import (
 	"github.com/DamienFontaine/lunarc/config"
 )
 
+func init() {
+	config.Register("smtp", Config{})
+}
+
 //Config configuration
 type Config struct {
-	Port int
-	Host string
+	Port int    `default:"587" validate:"max=65535"`
+	Host string `validate:"required"`
 	SSL  bool
 	Auth struct {
 		User     string
-		Password string
+		Password string `secret:"true"`
 	}
 }
 
@@ -54,6 +58,11 @@ func (se *SMTPEnvironment) UnmarshalYAML(unmarshal func(interface{}) error) erro
 	return nil
 }
 
+//Section returns the key of the SMTP configuration in an environment
+func (se *SMTPEnvironment) Section() string {
+	return "smtp"
+}
+
 //GetEnvironment returns a SMTP Server configuration for the specified environment in parameter
 func (se *SMTPEnvironment) GetEnvironment(environment string) interface{} {
 	for env, conf := range se.Env {
@@ -66,8 +75,10 @@ func (se *SMTPEnvironment) GetEnvironment(environment string) interface{} {
 
 //GetSMTP returns a SMTP Server configurations
 func GetSMTP(source interface{}, environment string) (smtp Config, err error) {
-	var smtpEnvironment SMTPEnvironment
-	i, err := config.Get(source, environment, &smtpEnvironment)
-	smtp = i.(Config)
+	loader, err := config.NewLoader(source, environment)
+	if err != nil {
+		return
+	}
+	err = loader.Section("smtp", &smtp)
 	return
 }
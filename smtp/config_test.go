@@ -87,8 +87,7 @@ func TestGetSMTPServerNormal(t *testing.T) {
   development:
     smtp:
       port: 465
-      jwt:
-        key: LunarcSecretKey
+      host: smtp.test.com
   `
 	smtp, err := GetSMTP([]byte(data), "development")
 	if err != nil {
@@ -98,3 +97,18 @@ func TestGetSMTPServerNormal(t *testing.T) {
 		t.Fatalf("Must return a Server with Port 465 not %v", smtp.Port)
 	}
 }
+
+func TestGetSMTPServerDefaultPort(t *testing.T) {
+	var data = `
+  development:
+    smtp:
+      host: smtp.test.com
+  `
+	smtp, err := GetSMTP([]byte(data), "development")
+	if err != nil {
+		t.Fatalf("Non expected error %v", err)
+	}
+	if smtp.Port != 587 {
+		t.Fatalf("Must return a Server with the default Port 587 not %v", smtp.Port)
+	}
+}
@@ -16,10 +16,25 @@
 package smtp
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/smtp"
+
+	"github.com/DamienFontaine/lunarc/config"
+	"github.com/DamienFontaine/lunarc/metrics"
+)
+
+var (
+	smtpSent     = metrics.NewCounter("lunarc_smtp_sent_total", "Number of emails sent.")
+	smtpFailures = metrics.NewCounter("lunarc_smtp_failures_total", "Number of emails which could not be sent.")
 )
 
+func init() {
+	metrics.MustRegister(smtpSent, smtpFailures)
+}
+
 //MailSender interface
 type MailSender interface {
 	SendMail(from string, to []string, msg []byte) error
@@ -28,27 +43,68 @@ type MailSender interface {
 //SMTP SMTP server
 type SMTP struct {
 	addr string
+	ssl  bool
 	auth smtp.Auth
 	send func(string, smtp.Auth, string, []string, []byte) error
 }
 
 //NewSMTP create new SMTP
 func NewSMTP(filename string, environment string) (s *SMTP, err error) {
-	conf, err := GetSMTP(filename, environment)
+	loader, err := config.NewLoader(filename, environment)
 	if err != nil {
 		return
 	}
+	return NewSMTPFromLoader(loader)
+}
+
+//NewSMTPFromLoader create new SMTP from the smtp section of a loaded configuration
+func NewSMTPFromLoader(loader *config.Loader) (s *SMTP, err error) {
+	var conf Config
+	if err = loader.Section("smtp", &conf); err != nil {
+		return
+	}
 	auth := smtp.PlainAuth("", conf.Auth.User, conf.Auth.Password, conf.Host)
 	f := smtp.SendMail
 	if conf.SSL {
 		f = SendMailSSL
 	}
-	s = &SMTP{auth: auth, send: f, addr: fmt.Sprintf("%s:%d", conf.Host, conf.Port)}
+	s = &SMTP{auth: auth, send: f, ssl: conf.SSL, addr: fmt.Sprintf("%s:%d", conf.Host, conf.Port)}
 	return
 }
 
 //SendMail send an email
 func (s *SMTP) SendMail(from string, to []string, msg []byte) (err error) {
 	err = s.send(s.addr, s.auth, from, to, msg)
+	if err != nil {
+		smtpFailures.Inc()
+	} else {
+		smtpSent.Inc()
+	}
 	return
 }
+
+//Check connects to the server and says EHLO, e.g. as a health check
+func (s *SMTP) Check(ctx context.Context) (err error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	host, _, _ := net.SplitHostPort(s.addr)
+	if s.ssl {
+		conn = tls.Client(conn, &tls.Config{ServerName: host})
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer c.Close()
+	if err = c.Hello("localhost"); err != nil {
+		return
+	}
+	return c.Quit()
+}
@@ -16,8 +16,14 @@
 package smtp
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
 	"net/smtp"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -44,3 +50,62 @@ func TestNewSMTPWithSSL(t *testing.T) {
 		t.Fatalf("SMTP with SSL must use SendMailSSL")
 	}
 }
+
+func TestSendMailMetrics(t *testing.T) {
+	var fail bool
+	s := &SMTP{send: func(string, smtp.Auth, string, []string, []byte) error {
+		if fail {
+			return errors.New("Connection refused")
+		}
+		return nil
+	}}
+	s.SendMail("lunarc@lunarc.io", []string{"doe@lunarc.io"}, nil)
+	fail = true
+	s.SendMail("lunarc@lunarc.io", []string{"doe@lunarc.io"}, nil)
+
+	var out bytes.Buffer
+	smtpSent.Collect(&out)
+	smtpFailures.Collect(&out)
+	if !strings.Contains(out.String(), "\nlunarc_smtp_sent_total 1\n") || !strings.Contains(out.String(), "\nlunarc_smtp_failures_total 1\n") {
+		t.Fatalf("Non expected metrics:\n%s", out.String())
+	}
+}
+
+func TestCheck(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		conn.Write([]byte("220 lunarc.io ESMTP\r\n"))
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				conn.Write([]byte("250 lunarc.io\r\n"))
+			case strings.HasPrefix(line, "QUIT"):
+				conn.Write([]byte("221 Bye\r\n"))
+				return
+			}
+		}
+	}()
+
+	s := &SMTP{addr: l.Addr().String()}
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	l.Close()
+	if err := s.Check(context.Background()); err == nil {
+		t.Fatalf("Expected error!")
+	}
+}
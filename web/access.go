@@ -0,0 +1,177 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+//RequestIDHeader carries the id of a request. Logging generates one when the
+//client did not send it.
+var RequestIDHeader = "X-Request-Id"
+
+//Access is a request written in the access log. It is the data of the template
+//formats, e.g. `{{.Client}} {{.Method}} {{.URI}} {{.Status}} {{.Latency}}`.
+type Access struct {
+	Time      time.Time
+	Client    string
+	User      string
+	Method    string
+	URI       string
+	Proto     string
+	Status    int
+	Length    int
+	Latency   time.Duration
+	Referer   string
+	UserAgent string
+	RequestID string
+}
+
+type accessKey struct{}
+
+//accessUser is filled by the handlers of a logged request
+type accessUser struct {
+	name string
+}
+
+//SetUser names the authenticated user of a request in the access log
+func SetUser(r *http.Request, user string) {
+	if u, ok := r.Context().Value(accessKey{}).(*accessUser); ok {
+		u.name = user
+	}
+}
+
+//AccessFormatter returns the formatter of an access log format: text, the logrus
+//text format, json, common and combined, the Apache Common and Combined Log
+//Formats, or a template of Access.
+func AccessFormatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case "", "text":
+		return &logrus.TextFormatter{}, nil
+	case "json":
+		return &logrus.JSONFormatter{}, nil
+	case "common":
+		return &apacheFormatter{}, nil
+	case "combined":
+		return &apacheFormatter{combined: true}, nil
+	}
+	if !strings.Contains(format, "{{") {
+		return nil, fmt.Errorf("unknown access log format %s", format)
+	}
+	t, err := template.New("access").Parse(format)
+	if err != nil {
+		return nil, err
+	}
+	return &templateFormatter{template: t}, nil
+}
+
+//apacheFormatter writes the Apache Common or Combined Log Format
+type apacheFormatter struct {
+	combined bool
+}
+
+func (f *apacheFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	a := accessOf(entry)
+	var b bytes.Buffer
+	client := a.Client
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+	length := "-"
+	if a.Length > 0 {
+		length = fmt.Sprint(a.Length)
+	}
+	fmt.Fprintf(&b, "%s - %s [%s] \"%s %s %s\" %d %s", dash(client), dash(a.User), a.Time.Format("02/Jan/2006:15:04:05 -0700"), a.Method, a.URI, a.Proto, a.Status, length)
+	if f.combined {
+		fmt.Fprintf(&b, " %q %q", dash(a.Referer), dash(a.UserAgent))
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+//templateFormatter writes an Access with a template
+type templateFormatter struct {
+	template *template.Template
+}
+
+func (f *templateFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	var b bytes.Buffer
+	if err := f.template.Execute(&b, accessOf(entry)); err != nil {
+		return nil, err
+	}
+	if b.Len() == 0 || b.Bytes()[b.Len()-1] != '\n' {
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), nil
+}
+
+//accessOf reads the fields of an entry written by Logging
+func accessOf(entry *logrus.Entry) Access {
+	str := func(key string) string {
+		s, _ := entry.Data[key].(string)
+		return s
+	}
+	status, _ := entry.Data["code"].(int)
+	length, _ := entry.Data["length"].(int)
+	latency, _ := entry.Data["latency"].(time.Duration)
+	return Access{
+		Time:      entry.Time,
+		Client:    str("client"),
+		User:      str("user"),
+		Method:    str("method"),
+		URI:       str("uri"),
+		Proto:     str("proto"),
+		Status:    status,
+		Length:    length,
+		Latency:   latency,
+		Referer:   str("referer"),
+		UserAgent: str("agent"),
+		RequestID: str("request_id"),
+	}
+}
+
+func dash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
+
+//requestID returns the id of the request, generating a new one when the client
+//did not send it.
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if len(id) == 0 {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return ""
+		}
+		id = hex.EncodeToString(b)
+		r.Header.Set(RequestIDHeader, id)
+	}
+	w.Header().Set(RequestIDHeader, id)
+	return id
+}
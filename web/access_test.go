@@ -0,0 +1,138 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/Sirupsen/logrus/hooks/test"
+)
+
+//logRequest serves a request through Logging with the access log format
+func logRequest(t *testing.T, format string, request *http.Request) string {
+	formatter, err := AccessFormatter(format)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = formatter
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetUser(r, "doe")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("Lunarc"))
+		w.Write([]byte("!"))
+	})
+	Logging(next, logger).ServeHTTP(httptest.NewRecorder(), request)
+	return out.String()
+}
+
+func newLoggedRequest() *http.Request {
+	request := httptest.NewRequest("POST", "/users?id=42", nil)
+	request.RemoteAddr = "192.168.1.10:53412"
+	request.Header.Set("Referer", "http://lunarc.io/")
+	request.Header.Set("User-Agent", "curl/7.58")
+	request.Header.Set(RequestIDHeader, "f00d")
+	return request
+}
+
+func TestAccessCombined(t *testing.T) {
+	line := logRequest(t, "combined", newLoggedRequest())
+	date := time.Now().Format("02/Jan/2006")
+	expected := `192.168.1.10 - doe [` + date
+	if !strings.HasPrefix(line, expected) {
+		t.Fatalf("Must start with %s but %v", expected, line)
+	}
+	if !strings.HasSuffix(line, `] "POST /users?id=42 HTTP/1.1" 201 7 "http://lunarc.io/" "curl/7.58"`+"\n") {
+		t.Fatalf("Non expected combined line: %v", line)
+	}
+	request := httptest.NewRequest("GET", "/", nil)
+	if line = logRequest(t, "common", request); !strings.Contains(line, `"GET / HTTP/1.1" 201 7`+"\n") {
+		t.Fatalf("Non expected common line: %v", line)
+	}
+}
+
+func TestAccessJSON(t *testing.T) {
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(logRequest(t, "json", newLoggedRequest())), &entry); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	for key, expected := range map[string]interface{}{
+		"user":       "doe",
+		"agent":      "curl/7.58",
+		"referer":    "http://lunarc.io/",
+		"request_id": "f00d",
+		"length":     float64(7),
+		"code":       float64(201),
+	} {
+		if entry[key] != expected {
+			t.Fatalf("Non expected %s: %v != %v", key, expected, entry[key])
+		}
+	}
+}
+
+func TestAccessTemplate(t *testing.T) {
+	line := logRequest(t, "{{.RequestID}} {{.User}} {{.Method}} {{.URI}} {{.Status}}", newLoggedRequest())
+	if line != "f00d doe POST /users?id=42 201\n" {
+		t.Fatalf("Non expected line: %q", line)
+	}
+	if _, err := AccessFormatter("{{.Unknown"); err == nil {
+		t.Fatalf("Expected error!")
+	}
+	if _, err := AccessFormatter("apache"); err == nil {
+		t.Fatalf("Expected error!")
+	}
+}
+
+func TestLoggingRequestID(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	var id string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = r.Header.Get(RequestIDHeader)
+	})
+	w := httptest.NewRecorder()
+	Logging(next, logger).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if len(id) == 0 || w.Header().Get(RequestIDHeader) != id {
+		t.Fatalf("Must generate a request id: %v %v", id, w.Header().Get(RequestIDHeader))
+	}
+	if hook.LastEntry().Data["request_id"] != id {
+		t.Fatalf("Must log the request id: %v", hook.LastEntry().Data)
+	}
+	if hook.LastEntry().Data["code"] != http.StatusOK {
+		t.Fatalf("A response without body must be logged as 200: %v", hook.LastEntry().Data["code"])
+	}
+}
+
+func TestLogFormatValidation(t *testing.T) {
+	var data = `
+  test:
+    server:
+      port: 8888
+      log:
+        format: apache`
+	_, err := GetConfig([]byte(data), "test")
+	if err == nil || !strings.Contains(err.Error(), "server.log.format") {
+		t.Fatalf("Must report server.log.format but %v", err)
+	}
+}
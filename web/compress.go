@@ -0,0 +1,450 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/andybalholm/brotli"
+)
+
+//Compression of the responses. A response is compressed when its type matches
+//Types, CompressibleTypes when empty, and it has at least MinSize bytes. The
+//coding is the one the client prefers among Encodings, which must have a
+//registered encoder, all the registered encoders when empty. Level is passed to the encoder, 0 meaning its default.
+type Compression struct {
+	Enable    bool
+	Level     int
+	MinSize   int `default:"1024"`
+	Types     []string
+	Encodings []string `validate:"encodings"`
+}
+
+//CompressibleTypes are the types compressed by default. A type ending with /*
+//matches a whole family.
+var CompressibleTypes = []string{
+	"text/*",
+	"application/javascript",
+	"application/json",
+	"application/manifest+json",
+	"application/xml",
+	"application/wasm",
+	"image/svg+xml",
+	"font/ttf",
+	"font/otf",
+}
+
+//Precompressed are the extensions of the precompressed siblings of a file by
+//content coding, in order of preference, e.g. app.js.br then app.js.gz for app.js.
+var Precompressed = []struct{ Coding, Extension string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+//Encoder returns a writer compressing to w at level
+type Encoder func(w io.Writer, level int) (io.WriteCloser, error)
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]Encoder{}
+	codings    []string
+)
+
+func init() {
+	RegisterEncoder("gzip", func(w io.Writer, level int) (io.WriteCloser, error) {
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	})
+	RegisterEncoder("br", func(w io.Writer, level int) (io.WriteCloser, error) {
+		if level == 0 {
+			level = brotli.DefaultCompression
+		}
+		if level < brotli.BestSpeed || level > brotli.BestCompression {
+			return nil, fmt.Errorf("invalid brotli level %d", level)
+		}
+		return brotli.NewWriterLevel(w, level), nil
+	})
+}
+
+//RegisterEncoder registers the encoder of a content coding, e.g. zstd, or
+//replaces the one of gzip or br. The last registered coding is preferred when a client accepts several.
+func RegisterEncoder(coding string, encoder Encoder) {
+	if encoder == nil {
+		panic("web: nil encoder " + coding)
+	}
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	if _, ok := encoders[coding]; !ok {
+		codings = append([]string{coding}, codings...)
+	}
+	encoders[coding] = encoder
+}
+
+//encoderOf returns the encoder of a coding, nil when it is not registered
+func encoderOf(coding string) Encoder {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	return encoders[coding]
+}
+
+//registered returns the registered codings in order of preference
+func registered() []string {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	return append([]string(nil), codings...)
+}
+
+//checkEncodings returns an error when a coding has no registered encoder
+func checkEncodings(encodings []string) error {
+	for _, coding := range encodings {
+		if encoderOf(coding) == nil {
+			return fmt.Errorf("%s has no registered encoder", coding)
+		}
+	}
+	return nil
+}
+
+//Compress compresses the responses according to conf, e.g.
+//mux.Use(web.Compress(conf.Compression)). Responses which already have a
+//Content-Encoding, e.g. precompressed files, are left as they are.
+func Compress(conf Compression) Middleware {
+	types := conf.Types
+	if len(types) == 0 {
+		types = CompressibleTypes
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var encodings []string
+			for _, coding := range conf.Encodings {
+				if encoderOf(coding) != nil {
+					encodings = append(encodings, coding)
+				}
+			}
+			if len(conf.Encodings) == 0 {
+				encodings = registered()
+			}
+			var coding string
+			if accepted := accept(r.Header.Get("Accept-Encoding"), encodings); len(accepted) > 0 && r.Method != http.MethodHead {
+				coding = accepted[0]
+			}
+			cw := &compressWriter{ResponseWriter: w, conf: conf, types: types, coding: coding}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+//compressWriter buffers the first MinSize bytes of a response to decide whether
+//to compress it
+type compressWriter struct {
+	http.ResponseWriter
+	conf    Compression
+	types   []string
+	coding  string
+	status  int
+	buf     []byte
+	started bool
+	encoder io.WriteCloser
+}
+
+//WriteHeader delays the status until the response is started
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if w.started {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if statusCode >= 100 && statusCode < 200 {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.status = statusCode
+	if !bodyAllowed(statusCode) {
+		w.start(true)
+	}
+}
+
+//Write buffers the data until MinSize bytes are written
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.started {
+		w.buf = append(w.buf, data...)
+		if len(w.buf) < w.conf.MinSize {
+			return len(data), nil
+		}
+		if err := w.start(false); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+//start writes the status and the buffered data, compressed when the response
+//is eligible. last is true when the response is complete.
+func (w *compressWriter) start(last bool) error {
+	w.started = true
+	h := w.Header()
+	if len(w.buf) > 0 && len(h.Get("Content-Type")) == 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if w.eligible(h, last) {
+		addVary(h, "Accept-Encoding")
+		if encoder := encoderOf(w.coding); encoder != nil {
+			e, err := encoder(w.ResponseWriter, w.conf.Level)
+			if err != nil {
+				log.Warningf("Can't compress with %s: %v", w.coding, err)
+			} else {
+				w.encoder = e
+				h.Set("Content-Encoding", w.coding)
+				h.Del("Content-Length")
+				h.Del("Accept-Ranges")
+			}
+		}
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+//eligible tells whether the response may be compressed
+func (w *compressWriter) eligible(h http.Header, last bool) bool {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if !bodyAllowed(status) || status == http.StatusPartialContent || len(h.Get("Content-Encoding")) > 0 {
+		return false
+	}
+	if last && len(w.buf) < w.conf.MinSize {
+		return false
+	}
+	if length, err := strconv.Atoi(h.Get("Content-Length")); err == nil && length < w.conf.MinSize {
+		return false
+	}
+	return matchType(h.Get("Content-Type"), w.types)
+}
+
+//Close completes the response
+func (w *compressWriter) Close() error {
+	if !w.started {
+		if err := w.start(true); err != nil {
+			return err
+		}
+	}
+	if w.encoder != nil {
+		return w.encoder.Close()
+	}
+	return nil
+}
+
+//Flush sends the data written so far, even below MinSize
+func (w *compressWriter) Flush() {
+	if !w.started {
+		w.start(false)
+	}
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//Hijack Satisfy the http.Hijacker interface
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("Not a Hijacker")
+}
+
+//bodyAllowed tells whether a response with status has a body
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+//matchType tells whether contentType is one of types
+func matchType(contentType string, types []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		if t == mediaType || strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+//addVary adds value to the Vary header unless it is already there
+func addVary(h http.Header, value string) {
+	for _, vary := range h["Vary"] {
+		for _, v := range strings.Split(vary, ",") {
+			if v = strings.TrimSpace(v); v == "*" || strings.EqualFold(v, value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
+
+//accept returns the codings accepted by header, from the preferred one. Codings
+//with the same quality keep their order.
+func accept(header string, codings []string) []string {
+	quality := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if len(coding) == 0 {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if param = strings.TrimSpace(param); strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		quality[coding] = q
+	}
+	var accepted []string
+	for _, coding := range codings {
+		q, ok := quality[coding]
+		if !ok {
+			q, ok = quality["*"]
+		}
+		if ok && q > 0 {
+			accepted = append(accepted, coding)
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return qualityOf(quality, accepted[i]) > qualityOf(quality, accepted[j])
+	})
+	return accepted
+}
+
+func qualityOf(quality map[string]float64, coding string) float64 {
+	if q, ok := quality[coding]; ok {
+		return q
+	}
+	return quality["*"]
+}
+
+//FileServer serves the files of root like http.FileServer, preferring their
+//precompressed siblings, see Precompressed.
+func FileServer(root http.FileSystem) http.Handler {
+	files := http.FileServer(root)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/") {
+			name = path.Join(name, "index.html")
+		}
+		if !servePrecompressed(w, r, root, name) {
+			files.ServeHTTP(w, r)
+		}
+	})
+}
+
+//servePrecompressed serves the precompressed sibling of name accepted by the
+//client. It returns false when there is none.
+func servePrecompressed(w http.ResponseWriter, r *http.Request, root http.FileSystem, name string) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	file, err := root.Open(name)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	var siblings []string
+	available := map[string]http.File{}
+	for _, p := range Precompressed {
+		sibling, err := root.Open(name + p.Extension)
+		if err != nil {
+			continue
+		}
+		defer sibling.Close()
+		siblings = append(siblings, p.Coding)
+		available[p.Coding] = sibling
+	}
+	if len(siblings) == 0 {
+		return false
+	}
+	addVary(w.Header(), "Accept-Encoding")
+	accepted := accept(r.Header.Get("Accept-Encoding"), siblings)
+	if len(accepted) == 0 {
+		return false
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if len(contentType) == 0 {
+		var buf [512]byte
+		n, _ := io.ReadFull(file, buf[:])
+		contentType = http.DetectContentType(buf[:n])
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Encoding", accepted[0])
+	http.ServeContent(w, r, name, info.ModTime(), available[accepted[0]])
+	return true
+}
+
+//serveFile serves filename, preferring its precompressed siblings
+func serveFile(w http.ResponseWriter, r *http.Request, filename string) {
+	dir, name := filepath.Split(filename)
+	if len(dir) == 0 {
+		dir = "."
+	}
+	if !servePrecompressed(w, r, http.Dir(dir), "/"+name) {
+		http.ServeFile(w, r, filename)
+	}
+}
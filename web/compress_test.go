@@ -0,0 +1,201 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus/hooks/test"
+	"github.com/andybalholm/brotli"
+)
+
+func compressed(h http.Handler, target, encoding string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("GET", target, nil)
+	request.Header.Set("Accept-Encoding", encoding)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, request)
+	return w
+}
+
+func TestCompress(t *testing.T) {
+	page := strings.Repeat("<p>Lunarc</p>", 200)
+	mux := NewLoggingServeMux(Config{Compression: Compression{Enable: true, MinSize: 1024}})
+	mux.log, _ = test.NewNullLogger()
+	hook := test.NewLocal(mux.log)
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(page))
+	})
+	mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<p>Lunarc</p>"))
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte(page))
+	})
+
+	w := compressed(mux, "/page", "br;q=0.5, gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Must be gzipped: %v", w.Header())
+	}
+	length := w.Body.Len()
+	r, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if body, _ := ioutil.ReadAll(r); string(body) != page {
+		t.Fatalf("Non expected body: %s", body)
+	}
+	if logged := hook.LastEntry().Data["length"]; logged != length {
+		t.Fatalf("Must log the compressed length %d but %v", length, logged)
+	}
+
+	w = compressed(mux, "/page", "identity")
+	if len(w.Header().Get("Content-Encoding")) > 0 || w.Header().Get("Vary") != "Accept-Encoding" || w.Body.String() != page {
+		t.Fatalf("Must not be compressed but vary: %v", w.Header())
+	}
+	for _, target := range []string{"/small", "/image"} {
+		w = compressed(mux, target, "gzip")
+		if len(w.Header().Get("Content-Encoding")) > 0 || len(w.Header().Get("Vary")) > 0 {
+			t.Fatalf("%s must not be compressed: %v", target, w.Header())
+		}
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	RegisterEncoder("deflate", func(w io.Writer, level int) (io.WriteCloser, error) {
+		return flate.NewWriter(w, flate.DefaultCompression)
+	})
+	if codings := registered(); codings[0] != "deflate" {
+		t.Fatalf("The last registered coding must be preferred: %v", codings)
+	}
+	h := Compress(Compression{MinSize: 10})(reply(strings.Repeat("lunarc ", 10)))
+	w := compressed(h, "/", "gzip, deflate")
+	if w.Header().Get("Content-Encoding") != "deflate" {
+		t.Fatalf("Must be deflated: %v", w.Header())
+	}
+	if body, _ := ioutil.ReadAll(flate.NewReader(w.Body)); string(body) != strings.Repeat("lunarc ", 10) {
+		t.Fatalf("Non expected body: %s", body)
+	}
+}
+
+func TestBrotli(t *testing.T) {
+	page := strings.Repeat("lunarc ", 10)
+	w := compressed(Compress(Compression{MinSize: 10, Encodings: []string{"br", "gzip"}})(reply(page)), "/", "gzip, br")
+	if w.Header().Get("Content-Encoding") != "br" {
+		t.Fatalf("Must be compressed with brotli: %v", w.Header())
+	}
+	if body, _ := ioutil.ReadAll(brotli.NewReader(w.Body)); string(body) != page {
+		t.Fatalf("Non expected body: %s", body)
+	}
+}
+
+func TestCompressUnregistered(t *testing.T) {
+	page := strings.Repeat("lunarc ", 10)
+	w := compressed(Compress(Compression{MinSize: 10, Encodings: []string{"zstd", "gzip"}})(reply(page)), "/", "zstd, gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Must fall back on a registered coding: %v", w.Header())
+	}
+
+	if _, err := GetConfig([]byte(`
+  test:
+    server:
+      port: 8888
+      compression:
+        encodings: [zstd, gzip]`), "test"); err == nil || !strings.Contains(err.Error(), "zstd") {
+		t.Fatalf("Must refuse a coding without encoder but %v", err)
+	}
+	if _, err := GetConfig([]byte(`
+  test:
+    server:
+      port: 8888
+      compression:
+        encodings: [br, gzip]`), "test"); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+}
+
+func TestAccept(t *testing.T) {
+	codings := []string{"br", "gzip", "deflate"}
+	for header, expected := range map[string][]string{
+		"gzip, br":             {"br", "gzip"},
+		"gzip;q=1.0, br;q=0.8": {"gzip", "br"},
+		"*;q=0.5, gzip":        {"gzip", "br", "deflate"},
+		"br;q=0, *":            {"gzip", "deflate"},
+		"identity":             nil,
+		"":                     nil,
+	} {
+		if accepted := accept(header, codings); !reflect.DeepEqual(accepted, expected) {
+			t.Fatalf("Non expected codings for %q: %v", header, accepted)
+		}
+	}
+}
+
+func TestPrecompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lunarc")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("console.log('lunarc')"))
+	zw.Close()
+	for name, content := range map[string][]byte{
+		"app.js":    []byte("console.log('lunarc')"),
+		"app.js.gz": gz.Bytes(),
+		"app.js.br": []byte("brotli"),
+		"robot.txt": []byte("robot"),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatalf("Non expected error: %v", err)
+		}
+	}
+
+	files := FileServer(http.Dir(dir))
+	w := compressed(files, "/app.js", "gzip, br")
+	if w.Header().Get("Content-Encoding") != "br" || w.Body.String() != "brotli" || !strings.Contains(w.Header().Get("Content-Type"), "javascript") {
+		t.Fatalf("Must serve app.js.br: %v %s", w.Header(), w.Body.String())
+	}
+	w = compressed(SingleFile(filepath.Join(dir, "app.js")), "/", "gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" || !bytes.Equal(w.Body.Bytes(), gz.Bytes()) || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Must serve app.js.gz: %v", w.Header())
+	}
+	w = compressed(files, "/app.js", "")
+	if len(w.Header().Get("Content-Encoding")) > 0 || w.Body.String() != "console.log('lunarc')" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Must serve app.js: %v", w.Header())
+	}
+	w = compressed(files, "/robot.txt", "gzip")
+	if len(w.Header().Get("Content-Encoding")) > 0 || len(w.Header().Get("Vary")) > 0 || w.Body.String() != "robot" {
+		t.Fatalf("Must serve robot.txt: %v", w.Header())
+	}
+
+	h := Compress(Compression{MinSize: 1})(files)
+	w = compressed(h, "/app.js", "gzip")
+	if !bytes.Equal(w.Body.Bytes(), gz.Bytes()) || w.Header()["Vary"][0] != "Accept-Encoding" || len(w.Header()["Vary"]) != 1 {
+		t.Fatalf("Must not compress twice: %v", w.Header())
+	}
+}
@@ -16,27 +16,127 @@
 package web
 
 import (
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/DamienFontaine/lunarc/config"
+	"github.com/DamienFontaine/lunarc/ratelimit"
+	"github.com/Sirupsen/logrus"
 )
 
+func init() {
+	config.Register("server", Config{})
+	config.RegisterValidator("loglevel", func(value interface{}, param string) error {
+		if _, err := logrus.ParseLevel(fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("%v is not a log level", value)
+		}
+		return nil
+	})
+	config.RegisterValidator("logformat", func(value interface{}, param string) error {
+		_, err := AccessFormatter(fmt.Sprint(value))
+		return err
+	})
+	config.RegisterValidator("tlsversion", func(value interface{}, param string) error {
+		_, err := MinVersion(fmt.Sprint(value))
+		return err
+	})
+	config.RegisterValidator("ciphers", func(value interface{}, param string) error {
+		names, _ := value.([]string)
+		_, err := CipherSuites(names)
+		return err
+	})
+	config.RegisterValidator("listeners", func(value interface{}, param string) error {
+		listeners, _ := value.([]Listener)
+		for i, l := range listeners {
+			if err := l.check(); err != nil {
+				return fmt.Errorf("listener %d %v", i, err)
+			}
+		}
+		return nil
+	})
+	config.RegisterValidator("ratelimits", func(value interface{}, param string) error {
+		limits, _ := value.(map[string]ratelimit.Limit)
+		for name, limit := range limits {
+			if err := checkRateLimit(limit); err != nil {
+				return fmt.Errorf("%s %v", name, err)
+			}
+		}
+		return nil
+	})
+	config.RegisterValidator("cors", func(value interface{}, param string) error {
+		cors, _ := value.(CORS)
+		return cors.check()
+	})
+	config.RegisterValidator("encodings", func(value interface{}, param string) error {
+		encodings, _ := value.([]string)
+		return checkEncodings(encodings)
+	})
+	config.RegisterValidator("clientauth", func(value interface{}, param string) error {
+		_, err := ClientAuth(fmt.Sprint(value), nil)
+		return err
+	})
+}
+
 //Config of a web server
 type Config struct {
-	Port  int
+	Port  int `validate:"required,max=65535"`
 	URL   string
 	Admin string
 	Log   struct {
-		File  string
-		Level string
+		File     string
+		Level    string `default:"ERROR" validate:"loglevel"`
+		Format   string `default:"text" validate:"logformat"`
+		Rotation Rotation
 	}
-	SSL struct {
-		Key         string
-		Certificate string
+	Compression Compression
+	CORS        CORS `validate:"cors"`
+	Static      Static
+	RateLimits  map[string]ratelimit.Limit `validate:"ratelimits"`
+	Listeners   []Listener                 `validate:"listeners"`
+	SSL         struct {
+		Key          string `validate:"file"`
+		Certificate  string `validate:"file"`
+		Certificates []KeyPair
+		MinVersion   string   `default:"1.2" validate:"tlsversion"`
+		Ciphers      []string `validate:"ciphers"`
+		Client       struct {
+			CA    []string `validate:"file"`
+			Auth  string   `validate:"clientauth"`
+			Allow []string
+		}
+		HSTS struct {
+			MaxAge     time.Duration
+			Subdomains bool
+			Preload    bool
+		}
 	}
 	Jwt struct {
-		Key string
+		Key string `secret:"true"`
+	}
+	Timeout struct {
+		Shutdown   time.Duration `default:"30s"`
+		Read       time.Duration `default:"60s"`
+		ReadHeader time.Duration `default:"10s"`
+		Write      time.Duration `default:"60s"`
+		Idle       time.Duration `default:"120s"`
 	}
+	Health struct {
+		Liveness  string
+		Readiness string
+		Grace     time.Duration
+		Disk      int
+	}
+	MaxHeaderBytes int `default:"65536"`
+	H2C            bool
+	Metrics        string
+}
+
+//KeyPair is a certificate and its key, served to the clients asking for one of
+//its names
+type KeyPair struct {
+	Certificate string `validate:"required,file"`
+	Key         string `validate:"required,file"`
 }
 
 //ServerEnvironment configurations
@@ -61,6 +161,11 @@ func (se *ServerEnvironment) UnmarshalYAML(unmarshal func(interface{}) error) er
 	return nil
 }
 
+//Section returns the key of the server configuration in an environment
+func (se *ServerEnvironment) Section() string {
+	return "server"
+}
+
 //GetEnvironment returns a Server configuration for the specified environment in parameter
 func (se *ServerEnvironment) GetEnvironment(environment string) interface{} {
 	for env, conf := range se.Env {
@@ -73,8 +178,10 @@ func (se *ServerEnvironment) GetEnvironment(environment string) interface{} {
 
 //GetConfig returns a Server configurations
 func GetConfig(source interface{}, environment string) (server Config, err error) {
-	var serverEnvironment ServerEnvironment
-	i, err := config.Get(source, environment, &serverEnvironment)
-	server = i.(Config)
+	loader, err := config.NewLoader(source, environment)
+	if err != nil {
+		return
+	}
+	err = loader.Section("server", &server)
 	return
 }
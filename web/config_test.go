@@ -139,3 +139,32 @@ func TestGetServerNormal(t *testing.T) {
 		t.Fatalf("Must return a Server with Port 8888 not %v", server.Port)
 	}
 }
+
+func TestGetServerWithJSONAndTOML(t *testing.T) {
+	for _, filename := range []string{"formats/config.json", "formats/config.toml"} {
+		server, err := GetConfig(filename, "test")
+		if err != nil {
+			t.Fatalf("Non expected error %v", err)
+		}
+		if server.Port != 8888 {
+			t.Fatalf("Must return a Server with Port 8888 not %v", server.Port)
+		}
+		if strings.Compare(server.Jwt.Key, "LunarcSecretKey") != 0 {
+			t.Fatalf("Must return a JWT key not %v", server.Jwt.Key)
+		}
+	}
+}
+
+func TestNewServerFromLoader(t *testing.T) {
+	loader, err := config.NewLoader("config.yml", "test")
+	if err != nil {
+		t.Fatalf("Non expected error %v", err)
+	}
+	server, err := NewServerFromLoader(loader)
+	if err != nil {
+		t.Fatalf("Non expected error %v", err)
+	}
+	if server.Config.Port != 8888 {
+		t.Fatalf("Must return a Server with Port 8888 not %v", server.Config.Port)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//CORS lets the pages of other origins call the server. Origins may have a
+//wildcard, e.g. https://*.lunarc.io, or be *, but not with Credentials. Methods and
+//Headers are the ones a request may use, DefaultMethods and DefaultHeaders when
+//empty, and Expose the headers of the answers a page may read.
+type CORS struct {
+	Origins     []string
+	Methods     []string
+	Headers     []string
+	Expose      []string
+	Credentials bool
+	MaxAge      time.Duration
+}
+
+//DefaultMethods and DefaultHeaders are allowed by a CORS without Methods or Headers
+var (
+	DefaultMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+	DefaultHeaders = []string{"Accept", "Accept-Language", "Content-Language", "Content-Type", "Authorization"}
+)
+
+//check reports * with credentials, which would let any page read the answers to
+//the requests of its users
+func (conf CORS) check() error {
+	if conf.Credentials && contains(conf.Origins, "*") {
+		return fmt.Errorf("origin * can't be used with credentials, list the origins")
+	}
+	return nil
+}
+
+//CrossOrigin answers the preflights of the origins of conf and adds the CORS
+//headers to their requests. It runs before the routing in a LoggingServeMux
+//configured with server.cors, so that a preflight gets no 401 or 405. With
+//Credentials, an origin * matches nothing.
+func CrossOrigin(conf CORS) Middleware {
+	origins := conf.Origins
+	if conf.Credentials {
+		origins = nil
+		for _, o := range conf.Origins {
+			if o != "*" {
+				origins = append(origins, o)
+			}
+		}
+	}
+	methods, headers := conf.Methods, conf.Headers
+	if len(methods) == 0 {
+		methods = DefaultMethods
+	}
+	if len(headers) == 0 {
+		headers = DefaultHeaders
+	}
+	anyHeader := contains(headers, "*")
+	anyOrigin := contains(conf.Origins, "*") && !conf.Credentials
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0
+			h := w.Header()
+			if !anyOrigin {
+				addVary(h, "Origin")
+			}
+			if len(origin) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !matchOrigin(origin, origins) {
+				if preflight {
+					http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if anyOrigin {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if conf.Credentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if !preflight {
+				if len(conf.Expose) > 0 {
+					h.Set("Access-Control-Expose-Headers", strings.Join(conf.Expose, ", "))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			addVary(h, "Access-Control-Request-Method")
+			addVary(h, "Access-Control-Request-Headers")
+			method := r.Header.Get("Access-Control-Request-Method")
+			requested := fields(r.Header.Get("Access-Control-Request-Headers"))
+			if !contains(methods, method) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			for _, header := range requested {
+				if !anyHeader && !contains(headers, header) {
+					http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+					return
+				}
+			}
+			h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if len(requested) > 0 {
+				h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+			}
+			if conf.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(conf.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+//matchOrigin tells whether origin is one of origins, which may have a wildcard
+func matchOrigin(origin string, origins []string) bool {
+	for _, o := range origins {
+		if i := strings.Index(o, "*"); i >= 0 {
+			if len(origin) > len(o)-1 && strings.HasPrefix(origin, o[:i]) && strings.HasSuffix(origin, o[i+1:]) {
+				return true
+			}
+		} else if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+//contains tells whether values has value, ignoring the case
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+//fields returns the values of a comma separated header
+func fields(header string) (values []string) {
+	for _, v := range strings.Split(header, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			values = append(values, v)
+		}
+	}
+	return
+}
@@ -0,0 +1,103 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus/hooks/test"
+)
+
+func TestCORSValidation(t *testing.T) {
+	var data = `
+  test:
+    server:
+      port: 8888
+      cors:
+        origins: ["*"]
+        credentials: true`
+	_, err := GetConfig([]byte(data), "test")
+	if err == nil || !strings.Contains(err.Error(), "server.cors") || !strings.Contains(err.Error(), "credentials") {
+		t.Fatalf("Must report server.cors but %v", err)
+	}
+}
+
+func crossOrigin(h http.Handler, method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, "/users", nil)
+	if len(origin) > 0 {
+		request.Header.Set("Origin", origin)
+	}
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, request)
+	return w
+}
+
+func TestCrossOrigin(t *testing.T) {
+	mux := NewLoggingServeMux(Config{CORS: CORS{
+		Origins:     []string{"https://lunarc.io", "https://*.lunarc.io"},
+		Expose:      []string{"X-Request-Id"},
+		Credentials: true,
+		MaxAge:      10 * time.Minute,
+	}})
+	mux.log, _ = test.NewNullLogger()
+	mux.Handle("GET /users", reply("users"))
+
+	w := crossOrigin(mux, "OPTIONS", "https://app.lunarc.io", map[string]string{"Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "authorization, content-type"})
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://app.lunarc.io" ||
+		w.Header().Get("Access-Control-Allow-Headers") != "authorization, content-type" || w.Header().Get("Access-Control-Max-Age") != "600" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("Must answer the preflight: %v %v", w.Code, w.Header())
+	}
+	for _, headers := range []map[string]string{
+		{"Access-Control-Request-Method": "BREW"},
+		{"Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Secret"},
+	} {
+		if w = crossOrigin(mux, "OPTIONS", "https://lunarc.io", headers); w.Code != http.StatusForbidden {
+			t.Fatalf("Must refuse the preflight %v: %v", headers, w.Code)
+		}
+	}
+	if w = crossOrigin(mux, "OPTIONS", "https://lunarc.io.evil.com", map[string]string{"Access-Control-Request-Method": "GET"}); w.Code != http.StatusForbidden {
+		t.Fatalf("Must refuse another origin: %v", w.Code)
+	}
+
+	w = crossOrigin(mux, "GET", "https://lunarc.io", nil)
+	if w.Body.String() != "users" || w.Header().Get("Access-Control-Allow-Origin") != "https://lunarc.io" || w.Header().Get("Access-Control-Expose-Headers") != "X-Request-Id" || w.Header().Get("Vary") != "Origin" {
+		t.Fatalf("Non expected answer: %v", w.Header())
+	}
+	w = crossOrigin(mux, "GET", "https://evil.com", nil)
+	if w.Body.String() != "users" || len(w.Header().Get("Access-Control-Allow-Origin")) > 0 {
+		t.Fatalf("Must not allow another origin: %v", w.Header())
+	}
+
+	mux.SetConfig(Config{CORS: CORS{Origins: []string{"*"}, Credentials: true}})
+	w = crossOrigin(mux, "GET", "https://evil.example", nil)
+	if len(w.Header().Get("Access-Control-Allow-Origin")) > 0 || len(w.Header().Get("Access-Control-Allow-Credentials")) > 0 {
+		t.Fatalf("Must not allow any origin with credentials: %v", w.Header())
+	}
+
+	mux.SetConfig(Config{CORS: CORS{Origins: []string{"*"}}})
+	w = crossOrigin(mux, "GET", "https://evil.com", nil)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || len(w.Header().Get("Vary")) > 0 {
+		t.Fatalf("Must allow any origin: %v", w.Header())
+	}
+}
@@ -17,31 +17,78 @@ package web
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"net"
 	"net/http"
+	"runtime/debug"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 )
 
-//Logging logs http requests
+//Logging logs http requests. The format of the lines is the formatter of log,
+//see AccessFormatter.
 func Logging(next http.Handler, log *logrus.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestID(w, r)
+		user := &accessUser{}
+		r = r.WithContext(context.WithValue(r.Context(), accessKey{}, user))
 		srw := StatusResponseWriter{w, 0, 0}
 		start := time.Now()
 		next.ServeHTTP(&srw, r)
 		end := time.Now()
 		latency := end.Sub(start)
 
-		log.WithField("client", r.RemoteAddr).WithField("latency", latency).WithField("length", srw.Length()).WithField("code", srw.Status()).Printf("%s %s %s", r.Method, r.URL, r.Proto)
+		if len(user.name) == 0 {
+			user.name, _, _ = r.BasicAuth()
+		}
+		uri := r.RequestURI
+		if len(uri) == 0 {
+			uri = r.URL.RequestURI()
+		}
+		fields := logrus.Fields{
+			"client":  r.RemoteAddr,
+			"latency": latency,
+			"length":  srw.Length(),
+			"code":    srw.Status(),
+			"method":  r.Method,
+			"uri":     uri,
+			"proto":   r.Proto,
+			"referer": r.Referer(),
+			"agent":   r.UserAgent(),
+		}
+		if len(user.name) > 0 {
+			fields["user"] = user.name
+		}
+		if len(id) > 0 {
+			fields["request_id"] = id
+		}
+		log.WithFields(fields).Printf("%s %s %s", r.Method, r.URL, r.Proto)
 	})
 }
 
-//SingleFile returns a handler
+//Recovery answers 500 to a request whose handler panics and logs the panic
+func Recovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				logrus.Errorf("Panic serving %s %s: %v\n%s", r.Method, r.URL, err, debug.Stack())
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+//SingleFile returns a handler serving filename, or its precompressed sibling, e.g.
+//filename.gz, when the client accepts it
 func SingleFile(filename string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, filename)
+		serveFile(w, r, filename)
 	})
 }
 
@@ -52,12 +99,15 @@ type StatusResponseWriter struct {
 	length int
 }
 
-// Status return status code
+// Status return status code, 200 when the handler did not call WriteHeader
 func (w *StatusResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
 	return w.status
 }
 
-// Length return response size
+// Length return response size, as sent: compressed when the response is compressed
 func (w *StatusResponseWriter) Length() int {
 	return w.length
 }
@@ -69,8 +119,16 @@ func (w *StatusResponseWriter) Header() http.Header {
 
 // Write Satisfy the http.ResponseWriter interface
 func (w *StatusResponseWriter) Write(data []byte) (int, error) {
-	w.length = len(data)
-	return w.ResponseWriter.Write(data)
+	n, err := w.ResponseWriter.Write(data)
+	w.length += n
+	return n, err
+}
+
+//Flush Satisfy the http.Flusher interface
+func (w *StatusResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
 }
 
 //Hijack Satisfy the http.ResponseWriter interface
@@ -59,3 +59,18 @@ func TestSingleFileNotFound(t *testing.T) {
 		t.Fatalf("Non expected code: %v", w.Code)
 	}
 }
+
+func TestRecovery(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/panic", nil)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	Recovery(next).ServeHTTP(w, request)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Non expected code: %v", w.Code)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//Listener is an additional address of a server: a TCP address, served like
+//server.port, a Unix domain socket, served without TLS, or, with Redirect, a TCP
+//address redirecting to HTTPS.
+type Listener struct {
+	Address     string
+	Socket      string
+	Permissions string
+	Redirect    bool
+}
+
+//check reports a listener without address or socket, with both, or with bad permissions
+func (l Listener) check() error {
+	if len(l.Address) > 0 == (len(l.Socket) > 0) {
+		return errors.New("needs an address or a socket")
+	}
+	if len(l.Permissions) > 0 {
+		if len(l.Socket) == 0 {
+			return errors.New("permissions only apply to a socket")
+		}
+		if _, err := strconv.ParseUint(l.Permissions, 8, 32); err != nil {
+			return fmt.Errorf("bad permissions %s, must be octal like 0660", l.Permissions)
+		}
+	}
+	return nil
+}
+
+//listener is a listener of a running server
+type listener struct {
+	net.Listener
+	tls      bool
+	redirect bool
+}
+
+//listen opens server.port and the listeners of the configuration. On error the
+//opened ones are closed.
+func listen(conf Config) (listeners []listener, err error) {
+	defer func() {
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			listeners = nil
+		}
+	}()
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", conf.Port))
+	if err != nil {
+		return
+	}
+	listeners = append(listeners, listener{Listener: l, tls: secure(conf)})
+	for _, c := range conf.Listeners {
+		if err = c.check(); err != nil {
+			return
+		}
+		if c.Redirect && !secure(conf) {
+			err = errors.New("a redirect listener needs server.ssl")
+			return
+		}
+		if len(c.Socket) > 0 {
+			l, err = listenSocket(c.Socket, c.Permissions)
+		} else {
+			l, err = net.Listen("tcp", c.Address)
+		}
+		if err != nil {
+			return
+		}
+		listeners = append(listeners, listener{Listener: l, tls: secure(conf) && len(c.Address) > 0 && !c.Redirect, redirect: c.Redirect})
+	}
+	return
+}
+
+//listenSocket listens on a Unix domain socket, replacing the socket left by a
+//previous run
+func listenSocket(path, permissions string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if len(permissions) > 0 {
+		mode, _ := strconv.ParseUint(permissions, 8, 32)
+		if err = os.Chmod(path, os.FileMode(mode)); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+//RedirectHTTPS redirects the requests to the same URL with https on port
+func RedirectHTTPS(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if port != 443 {
+			host = fmt.Sprintf("%s:%d", host, port)
+		}
+		code := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			code = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	})
+}
+
+//hsts returns the Strict-Transport-Security header of server.ssl.hsts, empty when disabled
+func hsts(conf Config) string {
+	if conf.SSL.HSTS.MaxAge <= 0 {
+		return ""
+	}
+	header := fmt.Sprintf("max-age=%d", int64(conf.SSL.HSTS.MaxAge.Seconds()))
+	if conf.SSL.HSTS.Subdomains {
+		header += "; includeSubDomains"
+	}
+	if conf.SSL.HSTS.Preload {
+		header += "; preload"
+	}
+	return header
+}
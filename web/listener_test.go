@@ -0,0 +1,128 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunListeners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lunarc")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "lunarc.sock")
+
+	server := getHTTPServer(t, "ssl")
+	server.Config.SSL.HSTS.MaxAge = time.Hour
+	server.Config.SSL.HSTS.Subdomains = true
+	server.Config.Listeners = []Listener{
+		{Address: "localhost:8889", Redirect: true},
+		{Address: "localhost:8890"},
+		{Socket: socket, Permissions: "0600"},
+	}
+	mux := server.Handler.(*LoggingServeMux)
+	mux.SetConfig(server.Config)
+	mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Run(context.Background())
+	}()
+	waitListening(t)
+
+	noRedirect := func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	c := &http.Client{CheckRedirect: noRedirect, Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := c.Get("http://localhost:8889/hello?name=doe")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "https://localhost:8888/hello?name=doe" {
+		t.Fatalf("Must redirect to HTTPS but %v %v", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	resp, err = c.Get("https://localhost:8890/hello")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	resp.Body.Close()
+	if hsts := resp.Header.Get("Strict-Transport-Security"); hsts != "max-age=3600; includeSubDomains" {
+		t.Fatalf("Non expected HSTS: %v", hsts)
+	}
+
+	info, err := os.Stat(socket)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Non expected socket: %v %v", info, err)
+	}
+	unix := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+	}}}
+	resp, err = unix.Get("http://lunarc/hello")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello" || len(resp.Header.Get("Strict-Transport-Security")) > 0 {
+		t.Fatalf("Non expected answer on the socket: %q %v", body, resp.Header)
+	}
+
+	server.Stop()
+	if err := <-errs; err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Fatalf("The socket must be removed: %v", err)
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	h := RedirectHTTPS(443)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "http://lunarc.io:80/users", nil))
+	if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != "https://lunarc.io/users" {
+		t.Fatalf("Non expected redirect: %v %v", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestListenersValidation(t *testing.T) {
+	var data = `
+  test:
+    server:
+      port: 8888
+      listeners:
+        - address: localhost:8889
+          socket: /tmp/lunarc.sock
+        - socket: /tmp/lunarc.sock
+          permissions: rw-rw----`
+	_, err := GetConfig([]byte(data), "test")
+	if err == nil || !strings.Contains(err.Error(), "server.listeners") || !strings.Contains(err.Error(), "address or a socket") {
+		t.Fatalf("Must report server.listeners but %v", err)
+	}
+}
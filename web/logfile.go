@@ -0,0 +1,232 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//rotatedSuffix is the layout of the time appended to a rotated file
+const rotatedSuffix = "20060102-150405.000"
+
+//DefaultKeep is the number of rotated files kept when Rotation.Keep is zero
+const DefaultKeep = 7
+
+//Rotation of a log file. The file is rotated once it reaches Size megabytes or
+//Every has elapsed since it was opened. Zero disables a criterion. Keep is the
+//number of rotated files kept, DefaultKeep when zero, all of them when negative.
+type Rotation struct {
+	Size     int
+	Every    time.Duration
+	Keep     int
+	Compress bool
+}
+
+//LogFile is a log file which can be reopened, possibly elsewhere, while it is written.
+//It is rotated according to its Rotation: the current file is renamed with a time
+//suffix, e.g. access.log.20181018-070825.000, gzipped when Compress is set, and
+//only the Keep most recent rotated files are kept.
+type LogFile struct {
+	mu       sync.Mutex
+	filename string
+	file     *os.File
+	size     int64
+	opened   time.Time
+	rotation Rotation
+	rotated  sync.WaitGroup
+	cleaning sync.Mutex
+}
+
+//OpenLogFile opens filename in append mode
+func OpenLogFile(filename string) (*LogFile, error) {
+	f := &LogFile{}
+	if err := f.Reopen(filename); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+//Filename returns the name of the file
+func (f *LogFile) Filename() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.filename
+}
+
+//SetRotation sets the rotation of the file
+func (f *LogFile) SetRotation(rotation Rotation) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rotation = rotation
+}
+
+//Write satisfy the io.Writer interface
+func (f *LogFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.due(len(p)) {
+		if err := f.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Can't rotate %s: %v\n", f.filename, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+//Rotate rotates the file now
+func (f *LogFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotate()
+}
+
+//Reopen closes the file and opens filename. An empty filename reopens the same file,
+//e.g. after it was moved by logrotate. On error the current file is kept.
+func (f *LogFile) Reopen(filename string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(filename) == 0 {
+		filename = f.filename
+	}
+	return f.open(filename)
+}
+
+//Close the file once the rotated files are compressed
+func (f *LogFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rotated.Wait()
+	return f.file.Close()
+}
+
+func (f *LogFile) open(filename string) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file = file
+	f.filename = filename
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+//due reports whether writing n bytes needs a rotation first
+func (f *LogFile) due(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.rotation.Size > 0 && f.size+int64(n) > int64(f.rotation.Size)<<20 {
+		return true
+	}
+	return f.rotation.Every > 0 && time.Since(f.opened) >= f.rotation.Every
+}
+
+//rotate renames the file and opens a new one, then compresses and removes the
+//rotated files in the background. Errors go to stderr as the standard logger
+//may write in f.
+func (f *LogFile) rotate() error {
+	rotated := f.filename + "." + time.Now().Format(rotatedSuffix)
+	if err := os.Rename(f.filename, rotated); err != nil {
+		return err
+	}
+	if err := f.open(f.filename); err != nil {
+		return err
+	}
+	filename, rotation := f.filename, f.rotation
+	f.rotated.Add(1)
+	go func() {
+		defer f.rotated.Done()
+		f.cleaning.Lock()
+		defer f.cleaning.Unlock()
+		if rotation.Compress {
+			if err := compress(rotated); err != nil {
+				fmt.Fprintf(os.Stderr, "Can't compress %s: %v\n", rotated, err)
+			}
+		}
+		keep := rotation.Keep
+		if keep == 0 {
+			keep = DefaultKeep
+		}
+		if keep > 0 {
+			clean(filename, keep)
+		}
+	}()
+	return nil
+}
+
+//compress gzips filename and removes it
+func compress(filename string) (err error) {
+	in, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	out, err := os.OpenFile(filename+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return
+	}
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err == nil {
+		err = gz.Close()
+	}
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(filename + ".gz")
+		return
+	}
+	return os.Remove(filename)
+}
+
+//clean removes the rotated files of filename but the keep most recent ones
+func clean(filename string, keep int) {
+	matches, err := filepath.Glob(filename + ".*")
+	if err != nil {
+		return
+	}
+	var rotated []string
+	for _, match := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(match, filename+"."), ".gz")
+		if _, err := time.Parse(rotatedSuffix, suffix); err == nil {
+			rotated = append(rotated, match)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(rotated)))
+	for i := keep; i < len(rotated); i++ {
+		if err := os.Remove(rotated[i]); err != nil {
+			fmt.Fprintf(os.Stderr, "Can't remove %s: %v\n", rotated[i], err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tempLogFile(t *testing.T) (dir string, f *LogFile) {
+	dir, err := ioutil.TempDir("", "lunarc")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	f, err = OpenLogFile(filepath.Join(dir, "access.log"))
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	return
+}
+
+func rotatedFiles(t *testing.T, dir string) []string {
+	matches, err := filepath.Glob(filepath.Join(dir, "access.log.*"))
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	return matches
+}
+
+func TestLogFileRotateSize(t *testing.T) {
+	dir, f := tempLogFile(t)
+	defer os.RemoveAll(dir)
+	f.SetRotation(Rotation{Size: 1, Keep: 2})
+
+	line := strings.Repeat("a", 1<<19) + "\n"
+	for i := 0; i < 7; i++ {
+		f.Write([]byte(line))
+		time.Sleep(2 * time.Millisecond)
+	}
+	f.Close()
+
+	if rotated := rotatedFiles(t, dir); len(rotated) != 2 {
+		t.Fatalf("Must keep 2 rotated files but %v", rotated)
+	}
+	info, err := os.Stat(filepath.Join(dir, "access.log"))
+	if err != nil || info.Size() != int64(len(line)) {
+		t.Fatalf("Non expected current file: %v %v", info, err)
+	}
+}
+
+func TestLogFileRotateKeepAll(t *testing.T) {
+	dir, f := tempLogFile(t)
+	defer os.RemoveAll(dir)
+	f.SetRotation(Rotation{Size: 1, Keep: -1})
+
+	line := strings.Repeat("a", 1<<19) + "\n"
+	for i := 0; i < 7; i++ {
+		f.Write([]byte(line))
+		time.Sleep(2 * time.Millisecond)
+	}
+	f.Close()
+
+	if rotated := rotatedFiles(t, dir); len(rotated) != 6 {
+		t.Fatalf("Must keep every rotated file but %v", rotated)
+	}
+}
+
+func TestLogFileRotateCompress(t *testing.T) {
+	dir, f := tempLogFile(t)
+	defer os.RemoveAll(dir)
+	f.SetRotation(Rotation{Every: time.Millisecond, Compress: true})
+
+	f.Write([]byte("first\n"))
+	time.Sleep(5 * time.Millisecond)
+	f.Write([]byte("second\n"))
+	f.Close()
+
+	rotated := rotatedFiles(t, dir)
+	if len(rotated) != 1 || !strings.HasSuffix(rotated[0], ".gz") {
+		t.Fatalf("Must compress the rotated file but %v", rotated)
+	}
+	in, err := os.Open(rotated[0])
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	defer in.Close()
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if content, _ := ioutil.ReadAll(gz); string(content) != "first\n" {
+		t.Fatalf("Non expected rotated content: %q", content)
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(dir, "access.log")); string(content) != "second\n" {
+		t.Fatalf("Non expected content: %q", content)
+	}
+}
+
+func TestLogFileReopen(t *testing.T) {
+	dir, f := tempLogFile(t)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "access.log")
+
+	f.Write([]byte("before\n"))
+	//Like logrotate
+	if err := os.Rename(filename, filename+".1"); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	f.Write([]byte("moved\n"))
+	if err := f.Reopen(""); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	f.Write([]byte("after\n"))
+	f.Close()
+
+	if content, _ := ioutil.ReadFile(filename + ".1"); string(content) != "before\nmoved\n" {
+		t.Fatalf("Non expected moved content: %q", content)
+	}
+	if content, _ := ioutil.ReadFile(filename); string(content) != "after\n" {
+		t.Fatalf("Non expected content: %q", content)
+	}
+}
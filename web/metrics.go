@@ -0,0 +1,71 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DamienFontaine/lunarc/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounter("lunarc_http_requests_total", "Number of HTTP requests.", "route", "method", "code")
+	httpLatency  = metrics.NewHistogram("lunarc_http_request_duration_seconds", "Latency of the HTTP requests.", nil, "route", "method", "code")
+	httpInFlight = metrics.NewGauge("lunarc_http_requests_in_flight", "Number of HTTP requests being served.", "route", "method")
+)
+
+func init() {
+	metrics.MustRegister(httpRequests, httpLatency, httpInFlight)
+}
+
+//setMetrics serves the metrics on server.metrics
+func setMetrics(mux *LoggingServeMux, conf Config) {
+	if len(conf.Metrics) > 0 {
+		mux.Handle("GET "+conf.Metrics, metrics.Handler())
+	}
+}
+
+//Metrics counts the requests, their latency and the requests in flight by route,
+//method and status. route names the route of a request, e.g. its pattern: the path
+//is not used as it would make a series by URL.
+func Metrics(next http.Handler, route func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, method := route(r), methodOf(r)
+		srw, ok := w.(*StatusResponseWriter)
+		if !ok {
+			srw = &StatusResponseWriter{ResponseWriter: w}
+		}
+		httpInFlight.Inc(name, method)
+		defer httpInFlight.Dec(name, method)
+		start := time.Now()
+		next.ServeHTTP(srw, r)
+		code := strconv.Itoa(srw.Status())
+		httpRequests.Inc(name, method, code)
+		httpLatency.Observe(time.Since(start).Seconds(), name, method, code)
+	})
+}
+
+//methodOf returns the method of a request, OTHER for an unknown method
+func methodOf(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return r.Method
+	}
+	return "OTHER"
+}
@@ -0,0 +1,70 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/DamienFontaine/lunarc/metrics"
+	"github.com/Sirupsen/logrus/hooks/test"
+)
+
+func TestMetrics(t *testing.T) {
+	mux := NewLoggingServeMux(Config{})
+	mux.log, _ = test.NewNullLogger()
+	mux.Handle("GET /metrics/users/{id}", reply("user"))
+	mux.HandleFunc("POST /metrics/users", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	serve(mux, "GET", "/metrics/users/42")
+	serve(mux, "GET", "/metrics/users/43")
+	serve(mux, "POST", "/metrics/users")
+	serve(mux, "BREW", "/metrics/users")
+	body := serve(mux, "GET", "/metrics").Body.String()
+
+	for _, expected := range []string{
+		`lunarc_http_requests_total{route="/metrics/users/{id}",method="GET",code="200"} 2`,
+		`lunarc_http_requests_total{route="/metrics/users",method="POST",code="201"} 1`,
+		`lunarc_http_requests_total{route="",method="OTHER",code="405"} 1`,
+		`lunarc_http_request_duration_seconds_count{route="/metrics/users/{id}",method="GET",code="200"} 2`,
+		`lunarc_http_requests_in_flight{route="/metrics/users/{id}",method="GET"} 0`,
+		`lunarc_http_requests_in_flight{route="/metrics",method="GET"} 1`,
+	} {
+		if !strings.Contains(body, expected+"\n") {
+			t.Fatalf("Must expose %s:\n%s", expected, body)
+		}
+	}
+}
+
+func TestSetMetrics(t *testing.T) {
+	mux := NewLoggingServeMux(Config{})
+	mux.log, _ = test.NewNullLogger()
+	setMetrics(mux, Config{})
+	if w := serve(mux, "GET", "/metrics"); w.Code != http.StatusNotFound {
+		t.Fatalf("The metrics must be opt-in: %v", w.Code)
+	}
+
+	mux = NewLoggingServeMux(Config{})
+	mux.log, _ = test.NewNullLogger()
+	setMetrics(mux, Config{Metrics: "/metrics"})
+	if w := serve(mux, "GET", "/metrics"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "lunarc_http_requests_total") {
+		t.Fatalf("Must serve the metrics on server.metrics: %v %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DamienFontaine/lunarc/ratelimit"
+	log "github.com/Sirupsen/logrus"
+)
+
+//checkRateLimit reports a limit without requests or with an unknown key
+func checkRateLimit(l ratelimit.Limit) error {
+	if l.Requests <= 0 {
+		return fmt.Errorf("needs requests")
+	}
+	if l.Interval() <= 0 {
+		return fmt.Errorf("has more requests than nanoseconds in its period")
+	}
+	if l.Key != "subject" {
+		if _, err := RateKey(l.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//KeyFunc returns the key of the bucket of a request
+type KeyFunc func(*http.Request) string
+
+//ClientIP is the key of the client IP of a request
+func ClientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+//HeaderKey returns the key of the value of a header, e.g. an API key, or of the
+//client IP without header
+func HeaderKey(name string) KeyFunc {
+	return func(r *http.Request) string {
+		if value := r.Header.Get(name); len(value) > 0 {
+			return name + ":" + value
+		}
+		return ClientIP(r)
+	}
+}
+
+//RateKey returns the KeyFunc of the key of a ratelimit.Limit, ip or header:NAME
+func RateKey(name string) (KeyFunc, error) {
+	switch {
+	case name == "" || name == "ip":
+		return ClientIP, nil
+	case strings.HasPrefix(name, "header:") && len(name) > len("header:"):
+		return HeaderKey(name[len("header:"):]), nil
+	}
+	return nil, fmt.Errorf("unknown key %s, must be ip, header:NAME or subject", name)
+}
+
+//RateLimiter limits the requests with the buckets of store, keyed by the name of
+//the limit and by key or, when nil, the Key of limit, e.g.
+//mux.Group("/auth", web.RateLimiter("auth", conf.RateLimits["auth"], store, nil)).
+//The limits sharing a store have their own buckets.
+//A limited request gets a 429 with Retry-After. Every answer has the RateLimit-Limit,
+//RateLimit-Remaining and RateLimit-Reset headers. A request goes through when the
+//store fails.
+func RateLimiter(name string, limit ratelimit.Limit, store ratelimit.Store, key KeyFunc) Middleware {
+	if err := checkRateLimit(limit); err != nil {
+		panic("web: bad rate limit: " + err.Error())
+	}
+	if key == nil {
+		var err error
+		if key, err = RateKey(limit.Key); err != nil {
+			panic("web: the " + limit.Key + " key needs a KeyFunc, e.g. security.RateLimiter")
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := store.Take(r.Context(), name+":"+key(r), limit)
+			if err != nil {
+				log.Warningf("Can't limit the rate of %s: %v", r.URL.Path, err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(limit.Size()))
+			h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+			if !result.Allowed {
+				h.Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+//seconds rounds d up to seconds
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,130 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DamienFontaine/lunarc/ratelimit"
+)
+
+func limited(h http.Handler, ip, apiKey string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("POST", "/auth", nil)
+	request.RemoteAddr = ip + ":53412"
+	if len(apiKey) > 0 {
+		request.Header.Set("X-Api-Key", apiKey)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, request)
+	return w
+}
+
+func TestRateLimiter(t *testing.T) {
+	h := RateLimiter("auth", ratelimit.Limit{Requests: 2, Period: time.Minute}, ratelimit.NewMemoryStore(), nil)(reply("auth"))
+	for i, remaining := range []string{"1", "0"} {
+		w := limited(h, "192.168.1.10", "")
+		if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != remaining {
+			t.Fatalf("Request %d must pass: %v %v", i, w.Code, w.Header())
+		}
+	}
+	w := limited(h, "192.168.1.10", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" || w.Header().Get("RateLimit-Reset") != "60" {
+		t.Fatalf("Must be limited: %v %v", w.Code, w.Header())
+	}
+	if w = limited(h, "192.168.1.11", ""); w.Code != http.StatusOK {
+		t.Fatalf("Another client must have its own bucket: %v", w.Code)
+	}
+
+	h = RateLimiter("api", ratelimit.Limit{Requests: 1, Key: "header:X-Api-Key"}, ratelimit.NewMemoryStore(), nil)(reply("auth"))
+	limited(h, "192.168.1.10", "key1")
+	if w = limited(h, "192.168.1.10", "key2"); w.Code != http.StatusOK {
+		t.Fatalf("Another API key must have its own bucket: %v", w.Code)
+	}
+	if w = limited(h, "192.168.1.11", "key1"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("An API key must be limited from any IP: %v", w.Code)
+	}
+}
+
+func TestRateLimitersShareStore(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	auth := RateLimiter("auth", ratelimit.Limit{Requests: 1, Period: time.Hour}, store, nil)(reply("auth"))
+	api := RateLimiter("api", ratelimit.Limit{Requests: 10, Period: time.Second, Burst: 2}, store, nil)(reply("api"))
+
+	limited(auth, "192.168.1.10", "")
+	if w := limited(auth, "192.168.1.10", ""); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Must be limited by auth: %v", w.Code)
+	}
+	for i := 0; i < 2; i++ {
+		if w := limited(api, "192.168.1.10", ""); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "2" {
+			t.Fatalf("Request %d must have its own api bucket: %v %v", i, w.Code, w.Header())
+		}
+	}
+	if w := limited(api, "192.168.1.10", ""); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("Must be limited by api: %v %v", w.Code, w.Header())
+	}
+	time.Sleep(150 * time.Millisecond)
+	if w := limited(auth, "192.168.1.10", ""); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("The auth bucket must not refill at the api rate: %v", w.Code)
+	}
+}
+
+func TestRateLimitsValidation(t *testing.T) {
+	conf, err := GetConfig([]byte(`
+  test:
+    server:
+      port: 8888
+      ratelimits:
+        auth:
+          requests: 5
+          period: 1m
+          key: subject`), "test")
+	if err != nil || conf.RateLimits["auth"] != (ratelimit.Limit{Requests: 5, Period: time.Minute, Key: "subject"}) {
+		t.Fatalf("Non expected rate limits: %v %v", conf.RateLimits, err)
+	}
+
+	var data = `
+  test:
+    server:
+      port: 8888
+      ratelimits:
+        auth:
+          requests: 5
+          period: 1m
+          key: subject
+        token:
+          requests: 5
+          key: cookie`
+	_, err = GetConfig([]byte(data), "test")
+	if err == nil || !strings.Contains(err.Error(), "server.ratelimits") || !strings.Contains(err.Error(), "unknown key cookie") {
+		t.Fatalf("Must report server.ratelimits but %v", err)
+	}
+
+	_, err = GetConfig([]byte(`
+  test:
+    server:
+      port: 8888
+      ratelimits:
+        flood:
+          requests: 2000000000
+          period: 1s`), "test")
+	if err == nil || !strings.Contains(err.Error(), "flood has more requests than nanoseconds") {
+		t.Fatalf("Must refuse a limit refilling in less than a nanosecond but %v", err)
+	}
+}
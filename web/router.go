@@ -0,0 +1,378 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//Middleware wraps a handler
+type Middleware func(http.Handler) http.Handler
+
+//Chain wraps handler with middleware, the first one running first
+func Chain(handler http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+type paramsKey struct{}
+
+//Params returns the path parameters of a request, e.g. id for /users/{id}
+func Params(r *http.Request) map[string]string {
+	params, _ := r.Context().Value(paramsKey{}).(map[string]string)
+	return params
+}
+
+//Param returns the path parameter name of a request
+func Param(r *http.Request, name string) string {
+	return Params(r)[name]
+}
+
+//Router dispatches the requests on their path and method. A pattern is a path
+//where {name} matches one segment, e.g. /users/{id}. Like http.ServeMux, a
+//pattern ending with a slash matches every path below it. A pattern may start
+//with a method, e.g. "GET /users/{id}", otherwise it matches every method.
+//
+//The most specific pattern wins: a fixed segment before a parameter, then an
+//exact pattern before a subtree. A path matched only for other methods gets a
+//405 with an Allow header.
+//
+//Middleware runs in this order: the middleware of the router, given to Use, then
+//the middleware of the groups, from the outermost, then the handler.
+type Router struct {
+	mu         sync.RWMutex
+	routes     map[string]*route
+	middleware []Middleware
+	handler    http.Handler
+}
+
+type route struct {
+	pattern  string
+	segments []string
+	subtree  bool
+	handlers map[string]http.Handler
+}
+
+//NewRouter allocates and returns a new Router
+func NewRouter() *Router {
+	return &Router{routes: make(map[string]*route)}
+}
+
+//Handle registers the handler for the given pattern
+func (rt *Router) Handle(pattern string, handler http.Handler) {
+	method, p := splitPattern(pattern)
+	if !strings.HasPrefix(p, "/") {
+		panic("web: invalid pattern " + pattern)
+	}
+	if handler == nil {
+		panic("web: nil handler for " + pattern)
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	r, ok := rt.routes[p]
+	if !ok {
+		r = newRoute(p)
+		rt.routes[p] = r
+	}
+	if _, ok := r.handlers[method]; ok {
+		panic("web: multiple registrations for " + pattern)
+	}
+	r.handlers[method] = handler
+}
+
+//HandleFunc registers the handler function for the given pattern
+func (rt *Router) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	rt.Handle(pattern, http.HandlerFunc(handler))
+}
+
+//Group returns a group registering its routes under prefix, wrapped by middleware
+func (rt *Router) Group(prefix string, middleware ...Middleware) *Group {
+	return &Group{router: rt, prefix: strings.TrimSuffix(prefix, "/"), middleware: middleware}
+}
+
+//With returns a group without prefix to wrap some routes with middleware, e.g.
+//router.With(auth).Handle("GET /users/{id}", users).
+func (rt *Router) With(middleware ...Middleware) *Group {
+	return rt.Group("", middleware...)
+}
+
+//Use appends middleware run for every request, before the routing: it also sees
+//the requests ending in a 404, 405 or redirect, but not their path parameters.
+func (rt *Router) Use(middleware ...Middleware) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.middleware = append(rt.middleware, middleware...)
+	rt.handler = Chain(http.HandlerFunc(rt.dispatch), rt.middleware...)
+}
+
+//Handler returns the handler to use for the given request and its pattern. It
+//never returns nil: a request without route gets a 404, 405 or redirect handler.
+func (rt *Router) Handler(r *http.Request) (h http.Handler, pattern string) {
+	if r.Method != http.MethodConnect {
+		if p := cleanPath(r.URL.Path); p != r.URL.Path {
+			return redirect(r, p), p
+		}
+	}
+	h, pattern, params, allow := rt.match(r.Method, r.URL.Path)
+	switch {
+	case h != nil:
+		if len(params) > 0 {
+			next := h
+			h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), paramsKey{}, params)))
+			})
+		}
+	case len(allow) > 0:
+		h = methodNotAllowed(allow)
+	default:
+		if h, pattern, _, _ = rt.match(r.Method, r.URL.Path+"/"); h != nil {
+			return redirect(r, r.URL.Path+"/"), pattern
+		}
+		h, pattern = http.NotFoundHandler(), ""
+	}
+	return
+}
+
+//Route returns the pattern of the route serving the request, empty when the request
+//gets a 404, 405 or redirect.
+func (rt *Router) Route(r *http.Request) string {
+	_, pattern, _, _ := rt.match(r.Method, r.URL.Path)
+	return pattern
+}
+
+//ServeHTTP runs the middleware of the router then the handler of the route
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mu.RLock()
+	h := rt.handler
+	rt.mu.RUnlock()
+	if h == nil {
+		rt.dispatch(w, r)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+//dispatch serves the request with the handler of its route
+func (rt *Router) dispatch(w http.ResponseWriter, r *http.Request) {
+	h, _ := rt.Handler(r)
+	h.ServeHTTP(w, r)
+}
+
+//match returns the handler of the most specific route of path accepting method,
+//or the methods accepted by the routes of path.
+func (rt *Router) match(method, p string) (h http.Handler, pattern string, params map[string]string, allow []string) {
+	segments := split(p)
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	var best *route
+	methods := make(map[string]bool)
+	for _, r := range rt.routes {
+		if !r.match(segments) {
+			continue
+		}
+		handler := r.handler(method)
+		if handler == nil {
+			for m := range r.handlers {
+				methods[m] = true
+			}
+			continue
+		}
+		if best == nil || r.moreSpecific(best) {
+			best, h = r, handler
+		}
+	}
+	if best == nil {
+		for m := range methods {
+			allow = append(allow, m)
+		}
+		if methods[http.MethodGet] && !methods[http.MethodHead] {
+			allow = append(allow, http.MethodHead)
+		}
+		sort.Strings(allow)
+		return
+	}
+	return h, best.pattern, best.params(segments), nil
+}
+
+func newRoute(pattern string) *route {
+	r := &route{pattern: pattern, segments: split(pattern), handlers: make(map[string]http.Handler)}
+	if n := len(r.segments); n > 0 && r.segments[n-1] == "" {
+		r.segments, r.subtree = r.segments[:n-1], true
+	}
+	names := make(map[string]bool)
+	for _, segment := range r.segments {
+		if name, ok := paramName(segment); ok {
+			if len(name) == 0 || names[name] {
+				panic(fmt.Sprintf("web: bad parameter %s in %s", segment, pattern))
+			}
+			names[name] = true
+		}
+	}
+	return r
+}
+
+//match reports whether the route matches the segments of a path
+func (r *route) match(segments []string) bool {
+	if r.subtree && len(segments) <= len(r.segments) {
+		return false
+	}
+	if !r.subtree && len(segments) != len(r.segments) {
+		return false
+	}
+	for i, segment := range r.segments {
+		if _, ok := paramName(segment); ok {
+			if len(segments[i]) == 0 {
+				return false
+			}
+		} else if segment != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//handler returns the handler of method, HEAD being served by GET
+func (r *route) handler(method string) http.Handler {
+	if h, ok := r.handlers[method]; ok {
+		return h
+	}
+	if h, ok := r.handlers[http.MethodGet]; ok && method == http.MethodHead {
+		return h
+	}
+	return r.handlers[""]
+}
+
+//moreSpecific reports whether r is preferred to other for a path both match
+func (r *route) moreSpecific(other *route) bool {
+	for i := 0; i < len(r.segments) || i < len(other.segments); i++ {
+		if a, b := rank(r.segments, i), rank(other.segments, i); a != b {
+			return a > b
+		}
+	}
+	return !r.subtree && other.subtree
+}
+
+func rank(segments []string, i int) int {
+	if i >= len(segments) {
+		return 0
+	}
+	if _, ok := paramName(segments[i]); ok {
+		return 1
+	}
+	return 2
+}
+
+func (r *route) params(segments []string) (params map[string]string) {
+	for i, segment := range r.segments {
+		if name, ok := paramName(segment); ok {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[name] = segments[i]
+		}
+	}
+	return
+}
+
+//Group registers routes under a prefix, wrapped by the middleware of the group
+type Group struct {
+	router     *Router
+	prefix     string
+	middleware []Middleware
+}
+
+//Handle registers the handler for the pattern under the prefix of the group
+func (g *Group) Handle(pattern string, handler http.Handler) {
+	method, p := splitPattern(pattern)
+	if len(method) > 0 {
+		method += " "
+	}
+	g.router.Handle(method+g.prefix+p, Chain(handler, g.middleware...))
+}
+
+//HandleFunc registers the handler function for the pattern under the prefix of the group
+func (g *Group) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	g.Handle(pattern, http.HandlerFunc(handler))
+}
+
+//Group returns a group nested in g, its middleware running after the middleware of g
+func (g *Group) Group(prefix string, middleware ...Middleware) *Group {
+	return &Group{router: g.router, prefix: g.prefix + strings.TrimSuffix(prefix, "/"), middleware: append(append([]Middleware(nil), g.middleware...), middleware...)}
+}
+
+//With returns a group nested in g without prefix
+func (g *Group) With(middleware ...Middleware) *Group {
+	return g.Group("", middleware...)
+}
+
+//Use appends middleware to the group. It wraps the routes registered afterwards.
+func (g *Group) Use(middleware ...Middleware) {
+	g.middleware = append(g.middleware, middleware...)
+}
+
+func splitPattern(pattern string) (method, p string) {
+	if i := strings.Index(pattern, " "); i >= 0 {
+		return strings.ToUpper(pattern[:i]), strings.TrimSpace(pattern[i+1:])
+	}
+	return "", pattern
+}
+
+func split(p string) []string {
+	return strings.Split(strings.TrimPrefix(p, "/"), "/")
+}
+
+func paramName(segment string) (string, bool) {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
+
+//cleanPath returns the canonical path of p, keeping its trailing slash
+func cleanPath(p string) string {
+	if len(p) == 0 {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	np := path.Clean(p)
+	if p[len(p)-1] == '/' && np != "/" {
+		np += "/"
+	}
+	return np
+}
+
+func redirect(r *http.Request, p string) http.Handler {
+	u := *r.URL
+	u.Path = p
+	return http.RedirectHandler(u.String(), http.StatusMovedPermanently)
+}
+
+func methodNotAllowed(allow []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	})
+}
@@ -0,0 +1,239 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus/hooks/test"
+)
+
+//reply writes name and the path parameters of the request
+func reply(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+		for _, key := range []string{"id", "file", "org"} {
+			if value := Param(r, key); len(value) > 0 {
+				w.Write([]byte(" " + key + "=" + value))
+			}
+		}
+	})
+}
+
+func serve(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, request)
+	return w
+}
+
+func TestRouterParams(t *testing.T) {
+	router := NewRouter()
+	router.Handle("/users/{id}", reply("user"))
+	router.Handle("/users/me", reply("me"))
+	router.Handle("/users/{id}/files/{file}", reply("file"))
+	router.Handle("/static/", reply("static"))
+	router.Handle("/", reply("root"))
+
+	for target, expected := range map[string]string{
+		"/users/42":          "user id=42",
+		"/users/me":          "me",
+		"/users/42/files/a":  "file id=42 file=a",
+		"/users/42/files":    "root",
+		"/static/css/a.css":  "static",
+		"/static/":           "static",
+		"/unknown/path":      "root",
+		"/users/42/files/a/": "root",
+	} {
+		w := serve(router, "GET", target)
+		if w.Code != http.StatusOK || w.Body.String() != expected {
+			t.Fatalf("%s must reply %q but %d %q", target, expected, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRouterNotFoundAndRedirect(t *testing.T) {
+	router := NewRouter()
+	router.Handle("/static/", reply("static"))
+	router.Handle("/users/{id}", reply("user"))
+
+	if w := serve(router, "GET", "/users"); w.Code != http.StatusNotFound {
+		t.Fatalf("Non expected code: %v", w.Code)
+	}
+	if w := serve(router, "GET", "/users/"); w.Code != http.StatusNotFound {
+		t.Fatalf("An empty parameter must not match: %v", w.Code)
+	}
+	w := serve(router, "GET", "/static?v=1")
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/static/?v=1" {
+		t.Fatalf("Must redirect to /static/ but %v %v", w.Code, w.Header().Get("Location"))
+	}
+	w = serve(router, "GET", "/users/../static/a")
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/static/a" {
+		t.Fatalf("Must redirect to the clean path but %v %v", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestRouterMethods(t *testing.T) {
+	router := NewRouter()
+	router.Handle("GET /users/{id}", reply("get"))
+	router.Handle("delete /users/{id}", reply("delete"))
+	router.Handle("POST /users/me", reply("post me"))
+	router.Handle("/any", reply("any"))
+
+	for _, c := range []struct{ method, target, expected string }{
+		{"GET", "/users/42", "get id=42"},
+		{"DELETE", "/users/42", "delete id=42"},
+		{"POST", "/users/me", "post me"},
+		{"GET", "/users/me", "get id=me"},
+		{"PATCH", "/any", "any"},
+	} {
+		w := serve(router, c.method, c.target)
+		if w.Code != http.StatusOK || w.Body.String() != c.expected {
+			t.Fatalf("%s %s must reply %q but %d %q", c.method, c.target, c.expected, w.Code, w.Body.String())
+		}
+	}
+
+	if w := serve(router, "HEAD", "/users/42"); w.Code != http.StatusOK {
+		t.Fatalf("HEAD must be served by GET: %v", w.Code)
+	}
+	w := serve(router, "PUT", "/users/me")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Non expected code: %v", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "DELETE, GET, HEAD, POST" {
+		t.Fatalf("Non expected Allow header: %v", allow)
+	}
+}
+
+func TestRouterGroup(t *testing.T) {
+	var calls []string
+	middleware := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	router := NewRouter()
+	api := router.Group("/api/", middleware("api"))
+	api.Handle("GET /users/{id}", reply("user"))
+	orgs := api.Group("/orgs/{org}", middleware("orgs"))
+	orgs.HandleFunc("/members", func(w http.ResponseWriter, r *http.Request) {
+		reply("members").ServeHTTP(w, r)
+	})
+	router.Handle("/public", reply("public"))
+
+	if w := serve(router, "GET", "/api/users/42"); w.Body.String() != "user id=42" {
+		t.Fatalf("Non expected body: %v", w.Body.String())
+	}
+	if w := serve(router, "GET", "/api/orgs/lunarc/members"); w.Body.String() != "members org=lunarc" {
+		t.Fatalf("Non expected body: %v", w.Body.String())
+	}
+	serve(router, "GET", "/public")
+	if strings.Join(calls, ",") != "api,api,orgs" {
+		t.Fatalf("Non expected middleware calls: %v", calls)
+	}
+}
+
+func TestRouterDuplicate(t *testing.T) {
+	router := NewRouter()
+	router.Handle("GET /users/{id}", reply("user"))
+	router.Handle("POST /users/{id}", reply("user"))
+	for _, pattern := range []string{"GET /users/{id}", "users", "/users/{id}/{id}"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("Expected panic for %s!", pattern)
+				}
+			}()
+			router.Handle(pattern, reply("user"))
+		}()
+	}
+}
+
+func TestLoggingServeMuxGroup(t *testing.T) {
+	mux := NewLoggingServeMux(Config{})
+	mux.log, _ = test.NewNullLogger()
+	mux.Group("/api").Handle("GET /users/{id}", reply("user"))
+	if w := serve(mux, "GET", "/api/users/42"); w.Body.String() != "user id=42" {
+		t.Fatalf("Non expected body: %v", w.Body.String())
+	}
+	if h, pattern := mux.Handler(httptest.NewRequest("GET", "/api/users/42", nil)); h == nil || pattern != "/api/users/{id}" {
+		t.Fatalf("Non expected pattern: %v", pattern)
+	}
+}
+
+func TestRouterUse(t *testing.T) {
+	var calls []string
+	middleware := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	router := NewRouter()
+	router.Use(middleware("mux1"), middleware("mux2"))
+	api := router.Group("/api", middleware("group"))
+	api.Use(middleware("group use"))
+	api.With(middleware("route")).Handle("/users/{id}", reply("user"))
+	router.Use(middleware("mux3"))
+
+	if w := serve(router, "GET", "/api/users/42"); w.Body.String() != "user id=42" {
+		t.Fatalf("Non expected body: %v", w.Body.String())
+	}
+	if order := strings.Join(calls, ","); order != "mux1,mux2,mux3,group,group use,route" {
+		t.Fatalf("Non expected middleware order: %v", order)
+	}
+
+	calls = nil
+	if w := serve(router, "GET", "/unknown"); w.Code != http.StatusNotFound {
+		t.Fatalf("Non expected code: %v", w.Code)
+	}
+	if order := strings.Join(calls, ","); order != "mux1,mux2,mux3" {
+		t.Fatalf("The middleware of the router must see a 404: %v", order)
+	}
+}
+
+func TestLoggingServeMuxLogsEveryRequest(t *testing.T) {
+	mux := NewLoggingServeMux(Config{})
+	var hook *test.Hook
+	mux.log, hook = test.NewNullLogger()
+	mux.Use(Recovery)
+	mux.HandleFunc("/func", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("func"))
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	serve(mux, "GET", "/func")
+	serve(mux, "GET", "/unknown")
+	if w := serve(mux, "GET", "/panic"); w.Code != http.StatusInternalServerError {
+		t.Fatalf("Non expected code: %v", w.Code)
+	}
+	if len(hook.Entries) != 3 {
+		t.Fatalf("Must log 3 requests but %v", len(hook.Entries))
+	}
+	if code := hook.LastEntry().Data["code"]; code != http.StatusInternalServerError {
+		t.Fatalf("Must log the status of the recovered panic but %v", code)
+	}
+}
@@ -17,13 +17,21 @@ package web
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
-	"fmt"
-	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/DamienFontaine/lunarc/config"
+	"github.com/DamienFontaine/lunarc/health"
 	"github.com/Sirupsen/logrus"
 	log "github.com/Sirupsen/logrus"
 )
@@ -39,90 +47,409 @@ type IServer interface {
 //Server is a Server with a specialize Context.
 type Server struct {
 	http.Server
-	Config    Config
-	Error     chan error
-	Done      chan bool
-	quit      chan bool
-	isStarted bool
+	Config      Config
+	Error       chan error
+	Done        chan bool
+	Health      *health.Health
+	cancel      context.CancelFunc
+	hooks       []func() error
+	source      interface{}
+	environment string
+	watcher     *config.Watcher
+	logFile     *LogFile
+	mu          sync.RWMutex
+	tls         *tlsState
 }
 
 //NewServer create a new instance of Server
 func NewServer(filename string, environment string) (server *Server, err error) {
-	conf, err := GetConfig(filename, environment)
+	loader, err := config.NewLoader(filename, environment)
+	if err != nil {
+		return
+	}
+	return NewServerFromLoader(loader)
+}
+
+//NewServerFromLoader create a new instance of Server from the server section of a loaded configuration
+func NewServerFromLoader(loader *config.Loader) (server *Server, err error) {
+	var conf Config
+	if err = loader.Section("server", &conf); err != nil {
+		return
+	}
 
-	logFile, err := os.OpenFile(conf.Log.File+logFilename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	mux := NewLoggingServeMux(conf)
+	server = &Server{Config: conf, Done: make(chan bool, 1), Error: make(chan error, 1), Health: health.New(), Server: http.Server{Handler: mux}, source: loader.Source(), environment: loader.Environment()}
+	server.setLog(conf)
+	server.setHealth(mux, conf)
+	setMetrics(mux, conf)
+	setStatic(mux, conf)
+	return
+}
+
+//setStatic serves server.static on its path and below
+func setStatic(mux *LoggingServeMux, conf Config) {
+	if len(conf.Static.Root) > 0 {
+		mux.Handle("GET "+strings.TrimSuffix(conf.Static.Path, "/")+"/", NewStatic(conf.Static, nil))
+	}
+}
+
+//setHealth serves the probes of the Health and checks the disk space of the logs
+func (s *Server) setHealth(mux *LoggingServeMux, conf Config) {
+	if len(conf.Health.Liveness) > 0 {
+		mux.Handle("GET "+conf.Health.Liveness, s.Health.Liveness())
+	}
+	if len(conf.Health.Readiness) > 0 {
+		mux.Handle("GET "+conf.Health.Readiness, s.Health.Readiness())
+	}
+	if conf.Health.Disk > 0 {
+		dir := filepath.Dir(conf.Log.File + logFilename)
+		s.Health.AddReadiness(health.Check{Name: "disk", Check: health.DiskSpace(dir, uint64(conf.Health.Disk)<<20), Cache: 10 * time.Second})
+	}
+}
+
+//setLog sets the output and the level of the Lunarc log
+func (s *Server) setLog(conf Config) {
+	var err error
+	if s.logFile == nil {
+		s.logFile, err = OpenLogFile(conf.Log.File + logFilename)
+		if err == nil {
+			log.SetOutput(s.logFile)
+		}
+	} else {
+		err = s.logFile.Reopen(conf.Log.File + logFilename)
+	}
+	if s.logFile != nil {
+		s.logFile.SetRotation(conf.Log.Rotation)
+	}
 	if err != nil {
-		log.SetOutput(os.Stderr)
+		if s.logFile == nil {
+			log.SetOutput(os.Stderr)
+		}
 		log.Warningf("Can't open logfile: %v", err)
-	} else {
-		log.SetOutput(logFile)
 	}
 
-	level := log.ErrorLevel
-	if strings.Compare(conf.Log.Level, "") != 0 {
-		level, _ = log.ParseLevel(conf.Log.Level)
-	} else {
-		log.Infof("Log Level: %v", level)
+	//The level is validated by the loader, a Config built by hand may have none
+	level, err := log.ParseLevel(conf.Log.Level)
+	if err != nil {
+		level = log.ErrorLevel
 	}
 	log.SetLevel(level)
+	log.Infof("Log Level: %v", level)
+}
 
-	server = &Server{Config: conf, Done: make(chan bool, 1), Error: make(chan error, 1), Server: http.Server{Handler: NewLoggingServeMux(conf)}, quit: make(chan bool), isStarted: false}
+//Watch reloads the configuration when its files change. The log level, the log
+//files, the TLS certificate, the client CAs, HSTS, the compression and CORS are
+//applied at once, other changes are reported and need a restart.
+func (s *Server) Watch() (err error) {
+	var serverEnvironment ServerEnvironment
+	watcher, err := config.NewWatcher(s.source, s.environment, &serverEnvironment)
+	if err != nil {
+		return
+	}
+	watcher.Subscribe(func(old, new interface{}) {
+		s.reload(old.(Config), new.(Config))
+	})
+	watcher.Start()
+	s.mu.Lock()
+	s.watcher = watcher
+	s.mu.Unlock()
 	return
 }
 
-//Start the server.
-func (s *Server) Start() (err error) {
-	log.Infof("Lunarc is starting on port :%d", s.Config.Port)
-	var l net.Listener
-	go func() {
-		l, err = net.Listen("tcp", fmt.Sprintf(":%d", s.Config.Port))
-		if err != nil {
+//reload applies a new configuration
+func (s *Server) reload(old, conf Config) {
+	s.mu.RLock()
+	loaded := s.tls != nil
+	s.mu.RUnlock()
+	if !reflect.DeepEqual(old.SSL, conf.SSL) && loaded {
+		if err := s.loadTLS(conf); err != nil {
+			log.Errorf("Can't reload TLS certificate, the current one is kept: %v", err)
+			conf.SSL = old.SSL
+		} else {
+			log.Infof("TLS certificate reloaded")
+		}
+	}
+	applied := old
+	applied.Log, applied.SSL = conf.Log, conf.SSL
+	if mux, ok := s.Handler.(*LoggingServeMux); ok {
+		mux.SetConfig(conf)
+		applied.Compression, applied.CORS = conf.Compression, conf.CORS
+	}
+	if old.Log != conf.Log {
+		s.setLog(conf)
+		log.Infof("Log configuration reloaded")
+	}
+	if keys := changed(config.Values(applied, "server", nil), config.Values(conf, "server", nil), "server"); len(keys) > 0 {
+		log.Warnf("%s changed: restart required", strings.Join(keys, ", "))
+	}
+	s.mu.Lock()
+	s.Config.Log, s.Config.SSL = applied.Log, applied.SSL
+	s.Config.Compression, s.Config.CORS = applied.Compression, applied.CORS
+	s.mu.Unlock()
+}
+
+//changed returns the sorted keys of the values which differ between two trees
+//of config.Values, the mappings being compared key by key
+func changed(old, new interface{}, path string) (keys []string) {
+	o, ok := old.(map[string]interface{})
+	n, isMap := new.(map[string]interface{})
+	if !ok || !isMap {
+		if !reflect.DeepEqual(old, new) {
+			keys = append(keys, path)
+		}
+		return
+	}
+	names := make(map[string]bool)
+	for name := range o {
+		names[name] = true
+	}
+	for name := range n {
+		names[name] = true
+	}
+	for name := range names {
+		keys = append(keys, changed(o[name], n[name], path+"."+name)...)
+	}
+	sort.Strings(keys)
+	return
+}
+
+//Signals stop a running server gracefully
+var Signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+//ReopenSignals reopen the log files and reload the TLS certificates of a running
+//server, e.g. after logrotate moved them
+var ReopenSignals = []os.Signal{syscall.SIGHUP}
+
+//ReopenLogs reopens lunarc.log and access.log at their paths
+func (s *Server) ReopenLogs() (err error) {
+	if s.logFile != nil {
+		err = s.logFile.Reopen("")
+	}
+	if mux, ok := s.Handler.(*LoggingServeMux); ok {
+		if e := mux.ReopenLog(); err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+//OnShutdown registers hooks run once the requests are drained, in reverse order of
+//registration, e.g. server.OnShutdown(mongo.Disconnect).
+func (s *Server) OnShutdown(hooks ...func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hooks...)
+}
+
+//Run serves server.port and server.listeners until ctx is done, one of the Signals is received or the server fails.
+//The in-flight requests are then given server.timeout.shutdown to complete, the
+//remaining connections are closed and the shutdown hooks are run. The log files
+//and the TLS certificates are reloaded on the ReopenSignals, the certificates also
+//when their files change.
+//
+//The readiness probe of the Health succeeds once the server listens. It fails
+//during server.health.grace before the requests are drained.
+func (s *Server) Run(ctx context.Context) (err error) {
+	s.mu.RLock()
+	conf := s.Config
+	s.mu.RUnlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.mu.Unlock()
+		return errors.New("Lunarc is already running")
+	}
+	s.cancel = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.cancel = nil
+		s.mu.Unlock()
+	}()
+
+	log.Infof("Lunarc is starting on port :%d", conf.Port)
+	listeners, err := listen(conf)
+	if err != nil {
+		log.Errorf("Error: %v", err)
+		return
+	}
+	if secure(conf) {
+		if err = s.loadTLS(conf); err != nil {
 			log.Errorf("Error: %v", err)
-			s.Error <- err
+			for _, l := range listeners {
+				l.Close()
+			}
 			return
 		}
-		s.isStarted = true
-		if len(s.Config.SSL.Certificate) > 0 && len(s.Config.SSL.Key) > 0 {
-			err = s.ServeTLS(l, s.Config.SSL.Certificate, s.Config.SSL.Key)
-			if err != nil && err != http.ErrServerClosed {
+		s.TLSConfig = &tls.Config{GetConfigForClient: s.getConfigForClient}
+	}
+	for _, l := range listeners[1:] {
+		log.Infof("Lunarc is listening on %s", l.Addr())
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, Signals...)
+	defer signal.Stop(signals)
+
+	reopen := make(chan os.Signal, 1)
+	signal.Notify(reopen, ReopenSignals...)
+	defer signal.Stop(reopen)
+
+	var certificates <-chan time.Time
+	if secure(conf) {
+		ticker := time.NewTicker(CertificateInterval)
+		defer ticker.Stop()
+		certificates = ticker.C
+	}
+
+	setLimits(&s.Server, conf)
+	redirect := &http.Server{Handler: RedirectHTTPS(conf.Port)}
+	setLimits(redirect, conf)
+	plain := &s.Server
+	if conf.H2C {
+		//net/http serves h2c itself so Shutdown drains those connections too
+		var protocols http.Protocols
+		protocols.SetHTTP1(true)
+		protocols.SetUnencryptedHTTP2(true)
+		plain = &http.Server{Handler: s.Handler, Protocols: &protocols}
+		setLimits(plain, conf)
+	}
+	served := make(chan error, len(listeners))
+	for _, l := range listeners {
+		server := &s.Server
+		switch {
+		case l.redirect:
+			server = redirect
+		case !l.tls:
+			server = plain
+		}
+		go func(server *http.Server, l listener) {
+			served <- s.serve(server, l)
+		}(server, l)
+	}
+	pending := len(listeners)
+	if s.Health != nil {
+		s.Health.SetStatus(health.Ready)
+	}
+
+wait:
+	for {
+		select {
+		case err = <-served:
+			pending--
+			if err != nil {
 				log.Errorf("%v", err)
-				l.Close()
-				s.Error <- err
-				s.quit <- true
 			}
-			close(s.quit)
-		} else {
-			err = s.Serve(l)
-			if err != nil && err != http.ErrServerClosed {
-				log.Errorf("%v", err)
-				s.Error <- err
-				s.quit <- true
+			break wait
+		case <-ctx.Done():
+			break wait
+		case sig := <-signals:
+			log.Infof("Lunarc received %v", sig)
+			break wait
+		case <-reopen:
+			if e := s.ReopenLogs(); e != nil {
+				log.Errorf("Can't reopen logfile: %v", e)
+			} else {
+				log.Info("Log files reopened")
 			}
-			close(s.quit)
+			s.reloadTLS(true)
+		case <-certificates:
+			s.reloadTLS(false)
 		}
-	}()
-
-	<-s.quit
+	}
+	log.Info("Lunarc is stopping...")
+	if s.Health != nil {
+		s.Health.SetStatus(health.Stopping)
+		if conf.Health.Grace > 0 && err == nil {
+			//Let the load balancers see the failing readiness probe
+			time.Sleep(conf.Health.Grace)
+		}
+	}
 
-	if err = s.Shutdown(context.Background()); err != nil {
-		log.Errorf("%v", err)
-		s.Error <- err
+	drain := context.Background()
+	if conf.Timeout.Shutdown > 0 {
+		var cancelDrain context.CancelFunc
+		drain, cancelDrain = context.WithTimeout(drain, conf.Timeout.Shutdown)
+		defer cancelDrain()
+	}
+	servers := []*http.Server{redirect, &s.Server}
+	if plain != &s.Server {
+		servers = append(servers, plain)
+	}
+	for _, server := range servers {
+		if e := server.Shutdown(drain); e != nil {
+			log.Errorf("Lunarc can't drain the requests: %v", e)
+			server.Close()
+			if err == nil {
+				err = e
+			}
+		}
+	}
+	for ; pending > 0; pending-- {
+		<-served
 	}
 
-	<-s.quit
+	s.mu.Lock()
+	hooks := s.hooks
+	if s.watcher != nil {
+		s.watcher.Stop()
+		s.watcher = nil
+	}
+	s.mu.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if e := hooks[i](); e != nil {
+			log.Errorf("Shutdown hook failed: %v", e)
+			if err == nil {
+				err = e
+			}
+		}
+	}
 
-	l = nil
 	log.Info("Lunarc terminated.")
-	s.isStarted = false
+	return
+}
+
+//serve accepts the connections of l with server until it is shut down
+func (s *Server) serve(server *http.Server, l listener) (err error) {
+	if l.tls {
+		err = server.ServeTLS(l, "", "")
+	} else {
+		err = server.Serve(l)
+	}
+	if err == http.ErrServerClosed {
+		err = nil
+	}
+	return
+}
+
+//setLimits applies the timeouts and the header limit of the configuration
+func setLimits(server *http.Server, conf Config) {
+	server.ReadTimeout = conf.Timeout.Read
+	server.ReadHeaderTimeout = conf.Timeout.ReadHeader
+	server.WriteTimeout = conf.Timeout.Write
+	server.IdleTimeout = conf.Timeout.Idle
+	server.MaxHeaderBytes = conf.MaxHeaderBytes
+}
+
+//Start runs the server until Stop is called or a signal is received. Error receives
+//the error which stopped the server, then Done receives true.
+func (s *Server) Start() (err error) {
+	if err = s.Run(context.Background()); err != nil {
+		s.Error <- err
+	}
 	s.Done <- true
 	return
 }
 
 //Stop the server.
 func (s *Server) Stop() {
-	if s.isStarted && s.quit != nil {
-		log.Info("Lunarc is stopping...")
-		s.quit <- true
+	s.mu.RLock()
+	cancel := s.cancel
+	s.mu.RUnlock()
+	if cancel != nil {
+		cancel()
 	} else {
 		log.Info("Lunarc is not running")
 		s.Error <- errors.New("Lunarc is not running")
@@ -132,44 +459,155 @@ func (s *Server) Stop() {
 
 const aFilename = "access.log"
 
-// LoggingServeMux logs HTTP requests
+// LoggingServeMux logs every HTTP request. Routes are matched by a Router.
 type LoggingServeMux struct {
-	serveMux *http.ServeMux
+	router   *Router
 	conf     Config
+	mu       sync.Mutex
+	log      *logrus.Logger
+	logFile  *LogFile
+	compress Middleware
+	cors     Middleware
 }
 
 // NewLoggingServeMux allocates and returns a new LoggingServeMux
 func NewLoggingServeMux(conf Config) *LoggingServeMux {
-	serveMux := http.NewServeMux()
-	return &LoggingServeMux{serveMux, conf}
+	mux := &LoggingServeMux{router: NewRouter(), conf: conf}
+	mux.setMiddleware()
+	return mux
+}
+
+// SetConfig applies a new configuration, reopening the access log when its path changed
+func (mux *LoggingServeMux) SetConfig(conf Config) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	changed := mux.conf.Log.File != conf.Log.File
+	mux.conf = conf
+	mux.setMiddleware()
+	if mux.log == nil {
+		return
+	}
+	mux.setFormatter()
+	if mux.logFile != nil {
+		mux.logFile.SetRotation(conf.Log.Rotation)
+	}
+	if !changed {
+		return
+	}
+	var err error
+	if mux.logFile == nil {
+		mux.logFile, err = OpenLogFile(conf.Log.File + aFilename)
+		if err == nil {
+			mux.log.Out = mux.logFile
+		}
+	} else {
+		err = mux.logFile.Reopen(conf.Log.File + aFilename)
+	}
+	if err != nil {
+		log.Warningf("Can't open logfile: %v", err)
+	}
+}
+
+// ReopenLog reopens the access log, e.g. after it was moved by logrotate
+func (mux *LoggingServeMux) ReopenLog() error {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.logFile == nil {
+		return nil
+	}
+	return mux.logFile.Reopen("")
+}
+
+// accessLog returns the logger shared by the handlers of the mux
+func (mux *LoggingServeMux) accessLog() *logrus.Logger {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.log != nil {
+		return mux.log
+	}
+	mux.log = logrus.New()
+	mux.setFormatter()
+	var err error
+	mux.logFile, err = OpenLogFile(mux.conf.Log.File + aFilename)
+	if err != nil {
+		mux.log.Out = os.Stderr
+		mux.log.Warningf("Can't open logfile: %v", err)
+	} else {
+		mux.logFile.SetRotation(mux.conf.Log.Rotation)
+		mux.log.Out = mux.logFile
+	}
+	return mux.log
+}
+
+// setFormatter applies the access log format of the configuration
+func (mux *LoggingServeMux) setFormatter() {
+	formatter, err := AccessFormatter(mux.conf.Log.Format)
+	if err != nil {
+		log.Warningf("Bad access log format: %v", err)
+		return
+	}
+	mux.log.Formatter = formatter
+}
+
+// setMiddleware applies server.compression and server.cors
+func (mux *LoggingServeMux) setMiddleware() {
+	mux.compress, mux.cors = nil, nil
+	if mux.conf.Compression.Enable {
+		mux.compress = Compress(mux.conf.Compression)
+	}
+	if len(mux.conf.CORS.Origins) > 0 {
+		mux.cors = CrossOrigin(mux.conf.CORS)
+	}
 }
 
 // Handler sastisfy interface
 func (mux *LoggingServeMux) Handler(r *http.Request) (h http.Handler, pattern string) {
-	return mux.serveMux.Handler(r)
+	return mux.router.Handler(r)
 }
 
-//ServeHTTP
+//ServeHTTP logs and measures the request, then runs the middleware and the handler
+//of its route. HTTPS responses get the Strict-Transport-Security of server.ssl.hsts,
+//the responses are compressed according to server.compression and the preflights
+//of server.cors are answered before the routing.
 func (mux *LoggingServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	mux.serveMux.ServeHTTP(w, r)
+	mux.mu.Lock()
+	header, compress, cors := hsts(mux.conf), mux.compress, mux.cors
+	mux.mu.Unlock()
+	if r.TLS != nil && len(header) > 0 {
+		w.Header().Set("Strict-Transport-Security", header)
+	}
+	var handler http.Handler = mux.router
+	if cors != nil {
+		handler = cors(handler)
+	}
+	handler = Metrics(handler, mux.router.Route)
+	if compress != nil {
+		handler = compress(handler)
+	}
+	Logging(handler, mux.accessLog()).ServeHTTP(w, r)
 }
 
-//Handle register handler
+//Handle register handler. See Router for the patterns.
 func (mux *LoggingServeMux) Handle(pattern string, handler http.Handler) {
-
-	var log = logrus.New()
-
-	logFile, err := os.OpenFile(mux.conf.Log.File+aFilename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		log.Out = os.Stderr
-		log.Warningf("Can't open logfile: %v", err)
-	} else {
-		log.Out = logFile
-	}
-	mux.serveMux.Handle(pattern, Logging(handler, log))
+	mux.router.Handle(pattern, handler)
 }
 
 // HandleFunc registers the handler function for the given pattern.
 func (mux *LoggingServeMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
-	mux.serveMux.Handle(pattern, http.HandlerFunc(handler))
+	mux.router.HandleFunc(pattern, handler)
+}
+
+// Use appends middleware run for every request, after the access log
+func (mux *LoggingServeMux) Use(middleware ...Middleware) {
+	mux.router.Use(middleware...)
+}
+
+// With returns a group wrapping its routes with middleware
+func (mux *LoggingServeMux) With(middleware ...Middleware) *Group {
+	return mux.router.With(middleware...)
+}
+
+// Group returns a group of routes sharing a prefix and middleware
+func (mux *LoggingServeMux) Group(prefix string, middleware ...Middleware) *Group {
+	return mux.router.Group(prefix, middleware...)
 }
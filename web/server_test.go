@@ -16,6 +16,7 @@
 package web
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -23,13 +24,17 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/Sirupsen/logrus/hooks/test"
 
-	"golang.org/x/net/http2"
 )
 
 func getHTTPServer(t *testing.T, env string) (s *Server) {
@@ -175,7 +180,7 @@ func TestStartWithSSLNormal(t *testing.T) {
 	errs := make(chan error, 1)
 
 	go func() {
-		client := &http.Client{Transport: &http2.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}}}}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, ForceAttemptHTTP2: true}}
 
 		response, err := client.Get("https://localhost:8888/")
 		if err != nil {
@@ -283,28 +288,24 @@ func TestStopNormal(t *testing.T) {
 	defer l.Close()
 }
 
-func TestStartWithSSLNoCertError(t *testing.T) {
-	server := getHTTPServer(t, "nocertssl")
-
-	go server.Start()
-
-	err := <-server.Error
+func TestNewServerWithSSLNoCertError(t *testing.T) {
+	_, err := NewServer("config.yml", "nocertssl")
 	if err == nil {
-		t.Fatalf("Expected error: Le fichier spécifié est introuvable")
+		t.Fatalf("Expected error: file ./ssl/NoCert.crt does not exist")
+	}
+	if !strings.Contains(err.Error(), "server.ssl.certificate") {
+		t.Fatalf("Error must name server.ssl.certificate: %v", err)
 	}
-	<-server.Done
 }
 
-func TestStartWithSSLNoKeyError(t *testing.T) {
-	server := getHTTPServer(t, "nokeyssl")
-
-	go server.Start()
-
-	err := <-server.Error
+func TestNewServerWithSSLNoKeyError(t *testing.T) {
+	_, err := NewServer("config.yml", "nokeyssl")
 	if err == nil {
-		t.Fatalf("Expected error: Le fichier spécifié est introuvable")
+		t.Fatalf("Expected error: file ./ssl/NoKey.key does not exist")
+	}
+	if !strings.Contains(err.Error(), "server.ssl.key") {
+		t.Fatalf("Error must name server.ssl.key: %v", err)
 	}
-	<-server.Done
 }
 
 func TestStartWithError(t *testing.T) {
@@ -380,3 +381,361 @@ func TestStopUnstarted(t *testing.T) {
 		}
 	}
 }
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lunarc")
+	if err != nil {
+		t.Fatalf("Error during test preparation : %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "config.yml")
+	write := func(port int, level string) {
+		data := fmt.Sprintf("test:\n  server:\n    port: %d\n    log:\n      file: %s/\n      level: %s\n", port, dir, level)
+		if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatalf("Error during test preparation : %v", err)
+		}
+	}
+	write(8888, "DEBUG")
+
+	server, err := NewServer(filename, "test")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if err = server.Watch(); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	defer server.watcher.Stop()
+
+	write(9999, "INFO")
+	if err = server.watcher.Reload(); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+
+	if logrus.GetLevel() != logrus.InfoLevel {
+		t.Fatalf("Log level must be reloaded: %v", logrus.GetLevel())
+	}
+	if server.Config.Log.Level != "INFO" {
+		t.Fatalf("Config must contain the new log level: %v", server.Config.Log.Level)
+	}
+	if server.Config.Port != 8888 {
+		t.Fatalf("Port must not change before a restart: %v", server.Config.Port)
+	}
+}
+
+func TestReload(t *testing.T) {
+	server := getHTTPServer(t, "test")
+	m := server.Handler.(*LoggingServeMux)
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	old := server.Config
+	conf := old
+	conf.Compression = Compression{Enable: true, MinSize: 1024}
+	conf.CORS = CORS{Origins: []string{"https://lunarc.io"}}
+	server.reload(old, conf)
+	for _, entry := range hook.Entries {
+		if strings.Contains(entry.Message, "restart required") {
+			t.Fatalf("Compression and CORS must be applied without restart: %s", entry.Message)
+		}
+	}
+	if !server.Config.Compression.Enable || len(server.Config.CORS.Origins) != 1 || m.compress == nil || m.cors == nil {
+		t.Fatalf("Compression and CORS must be reloaded: %v %v", server.Config.Compression, server.Config.CORS)
+	}
+
+	old = server.Config
+	conf = old
+	conf.Port = 9999
+	conf.Listeners = []Listener{{Socket: "/tmp/lunarc.sock"}}
+	conf.H2C = true
+	conf.Timeout.Write = time.Minute + old.Timeout.Write
+	server.reload(old, conf)
+	expected := "server.h2c, server.listeners, server.port, server.timeout.write changed: restart required"
+	if entry := hook.LastEntry(); entry == nil || entry.Message != expected {
+		t.Fatalf("Must report every change needing a restart: %v", entry)
+	}
+
+	server.tls = &tlsState{}
+	old = server.Config
+	conf = old
+	conf.SSL.Certificate, conf.SSL.Key = "missing.crt", "missing.key"
+	conf.SSL.HSTS.MaxAge = time.Hour
+	server.reload(old, conf)
+	if len(hsts(m.conf)) > 0 || len(server.Config.SSL.Certificate) > 0 {
+		t.Fatalf("A failed TLS reload must keep the SSL configuration: %q %v", hsts(m.conf), server.Config.SSL.Certificate)
+	}
+}
+
+//waitListening waits until the server accepts connections on port 8888
+func waitListening(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		conn, err := net.Dial("tcp", "localhost:8888")
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("Server not listening")
+}
+
+func TestRunDrain(t *testing.T) {
+	server := getHTTPServer(t, "test")
+	m := server.Handler.(*LoggingServeMux)
+	m.Handle("/slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+		w.Write([]byte("done"))
+	}))
+	var hooks []string
+	server.OnShutdown(func() error {
+		hooks = append(hooks, "mongo")
+		return nil
+	}, func() error {
+		hooks = append(hooks, "smtp")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Run(ctx)
+	}()
+	waitListening(t)
+
+	bodies := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://localhost:8888/slow")
+		if err != nil {
+			bodies <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		bodies <- string(body)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+
+	if body := <-bodies; body != "done" {
+		t.Fatalf("In-flight request must complete but %v", body)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	if strings.Join(hooks, ",") != "smtp,mongo" {
+		t.Fatalf("Hooks must run in reverse order but %v", hooks)
+	}
+}
+
+func TestRunDrainTimeout(t *testing.T) {
+	server := getHTTPServer(t, "test")
+	server.Config.Timeout.Shutdown = 100 * time.Millisecond
+	m := server.Handler.(*LoggingServeMux)
+	m.Handle("/slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Second)
+	}))
+	hook := errors.New("disconnect failed")
+	server.OnShutdown(func() error {
+		return hook
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Run(ctx)
+	}()
+	waitListening(t)
+	go http.Get("http://localhost:8888/slow")
+	time.Sleep(200 * time.Millisecond)
+
+	start := time.Now()
+	cancel()
+	err := <-errs
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Must report the drain timeout but %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Must not wait for the request: %v", elapsed)
+	}
+}
+
+func TestRunSignal(t *testing.T) {
+	//Keep the test process alive whatever happens
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	server := getHTTPServer(t, "test")
+	stopped := false
+	server.OnShutdown(func() error {
+		stopped = true
+		return nil
+	})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Run(context.Background())
+	}()
+	waitListening(t)
+	time.Sleep(100 * time.Millisecond)
+
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("Non expected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("SIGTERM must stop the server")
+	}
+	if !stopped {
+		t.Fatalf("Shutdown hooks must run")
+	}
+}
+
+func TestRunTwice(t *testing.T) {
+	server := getHTTPServer(t, "test")
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Run(ctx)
+	}()
+	waitListening(t)
+	if err := server.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Fatalf("Expected error: Lunarc is already running but %v", err)
+	}
+	cancel()
+	<-errs
+}
+
+func TestRunReadiness(t *testing.T) {
+	server := getHTTPServer(t, "test")
+	m := server.Handler.(*LoggingServeMux)
+	if w := serve(m, "GET", "/healthz"); strings.Contains(w.Body.String(), `"status"`) {
+		t.Fatalf("The probes must be opt-in: %v %v", w.Code, w.Body.String())
+	}
+	server.Config.Health.Liveness, server.Config.Health.Readiness = "/healthz", "/readyz"
+	server.Config.Health.Grace = 500 * time.Millisecond
+	server.setHealth(m, server.Config)
+	if w := serve(server.Handler, "GET", "/readyz"); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"starting"`) {
+		t.Fatalf("Must not be ready before Run: %v %v", w.Code, w.Body.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Run(ctx)
+	}()
+	waitListening(t)
+
+	status := func(path string) int {
+		resp, err := http.Get("http://localhost:8888" + path)
+		if err != nil {
+			t.Fatalf("Non expected error: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := status("/readyz"); code != http.StatusOK {
+		t.Fatalf("Must be ready: %v", code)
+	}
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	if code := status("/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("Must not be ready while stopping: %v", code)
+	}
+	if code := status("/healthz"); code != http.StatusOK {
+		t.Fatalf("Must be alive while stopping: %v", code)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+}
+
+func TestRunTimeouts(t *testing.T) {
+	server := getHTTPServer(t, "test")
+	if server.Config.Timeout.ReadHeader != 10*time.Second || server.Config.Timeout.Idle != 120*time.Second || server.Config.MaxHeaderBytes != 65536 {
+		t.Fatalf("Non expected defaults: %v %v", server.Config.Timeout, server.Config.MaxHeaderBytes)
+	}
+	server.Config.Timeout.ReadHeader = 200 * time.Millisecond
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Run(context.Background())
+	}()
+	waitListening(t)
+
+	conn, err := net.Dial("tcp", "localhost:8888")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n"))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	start := time.Now()
+	ioutil.ReadAll(conn)
+	if time.Since(start) > time.Second {
+		t.Fatalf("A slow client must be disconnected after the header timeout")
+	}
+
+	server.Stop()
+	if err := <-errs; err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+}
+
+func TestRunH2C(t *testing.T) {
+	server := getHTTPServer(t, "test")
+	server.Config.H2C = true
+	m := server.Handler.(*LoggingServeMux)
+	m.HandleFunc("/proto", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	started := make(chan struct{})
+	m.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("drained"))
+	})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Run(context.Background())
+	}()
+	waitListening(t)
+
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	c := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+	resp, err := c.Get("http://localhost:8888/proto")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "HTTP/2.0" {
+		t.Fatalf("Must serve HTTP/2 in cleartext but %s", body)
+	}
+	resp, err = http.Get("http://localhost:8888/proto")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "HTTP/1.1" {
+		t.Fatalf("Must still serve HTTP/1.1 but %s", body)
+	}
+
+	go func() {
+		<-started
+		server.Stop()
+	}()
+	resp, err = c.Get("http://localhost:8888/slow")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "drained" {
+		t.Fatalf("Must drain the HTTP/2 requests in cleartext but %s", body)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+}
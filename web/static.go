@@ -0,0 +1,268 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Static is a static site served on Path from the directory Root. Fallback serves
+//Index for the unknown paths without extension, e.g. the routes of a single page
+//application. Cache maps the extensions, e.g. .js, to their Cache-Control, *
+//matching the others. NotFound is the page, in Root, of the unknown paths.
+type Static struct {
+	Path     string `default:"/"`
+	Root     string `validate:"dir"`
+	Index    string `default:"index.html"`
+	Fallback bool
+	Listing  bool
+	NotFound string
+	Cache    map[string]string
+}
+
+//NewStatic returns a handler serving the static site of conf from fsys, e.g. an
+//embed.FS built into the binary, or from conf.Root when fsys is nil. Files have
+//a strong ETag and are served precompressed when they have siblings, see
+//Precompressed.
+func NewStatic(conf Static, fsys fs.FS) http.Handler {
+	if fsys == nil {
+		fsys = os.DirFS(conf.Root)
+	}
+	if len(conf.Index) == 0 {
+		conf.Index = "index.html"
+	}
+	return &static{conf: conf, fsys: fsys, prefix: strings.TrimSuffix(conf.Path, "/"), etags: make(map[string]etag)}
+}
+
+type static struct {
+	conf   Static
+	fsys   fs.FS
+	prefix string
+	mu     sync.Mutex
+	etags  map[string]etag
+}
+
+type etag struct {
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+func (s *static) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, s.prefix))
+	info, err := fs.Stat(s.fsys, fsName(name))
+	switch {
+	case err == nil && info.IsDir():
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			target := path.Base(r.URL.Path) + "/"
+			if len(r.URL.RawQuery) > 0 {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		index := path.Join(name, s.conf.Index)
+		if info, err := fs.Stat(s.fsys, fsName(index)); err == nil && !info.IsDir() {
+			s.serveFile(w, r, index, http.StatusOK)
+			return
+		}
+		if s.conf.Listing {
+			s.list(w, name)
+			return
+		}
+	case err == nil:
+		s.serveFile(w, r, name, http.StatusOK)
+		return
+	}
+	if s.conf.Fallback && len(path.Ext(name)) == 0 {
+		s.serveFile(w, r, "/"+s.conf.Index, http.StatusOK)
+		return
+	}
+	if len(s.conf.NotFound) > 0 {
+		s.serveFile(w, r, path.Clean("/"+s.conf.NotFound), http.StatusNotFound)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+//serveFile serves name, or its precompressed sibling accepted by the client, with
+//status. The requests of an OK file may be conditional or ranges.
+func (s *static) serveFile(w http.ResponseWriter, r *http.Request, name string, status int) {
+	var siblings []string
+	for _, p := range Precompressed {
+		if info, err := fs.Stat(s.fsys, fsName(name+p.Extension)); err == nil && !info.IsDir() {
+			siblings = append(siblings, p.Coding)
+		}
+	}
+	served := name
+	if len(siblings) > 0 {
+		addVary(w.Header(), "Accept-Encoding")
+		if accepted := accept(r.Header.Get("Accept-Encoding"), siblings); len(accepted) > 0 {
+			w.Header().Set("Content-Encoding", accepted[0])
+			for _, p := range Precompressed {
+				if p.Coding == accepted[0] {
+					served = name + p.Extension
+				}
+			}
+		}
+	}
+
+	file, err := s.fsys.Open(fsName(served))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if len(contentType) == 0 {
+		contentType = s.sniff(name)
+	}
+	w.Header().Set("Content-Type", contentType)
+	if cache := s.cacheControl(name); len(cache) > 0 {
+		w.Header().Set("Cache-Control", cache)
+	}
+	if status != http.StatusOK {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		w.WriteHeader(status)
+		if r.Method != http.MethodHead {
+			io.Copy(w, file)
+		}
+		return
+	}
+	tag, err := s.etag(served, info)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	w.Header().Set("ETag", tag)
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			s.fail(w, err)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+//etag returns the strong ETag of name, a hash of its content computed once for a
+//given modification time and size
+func (s *static) etag(name string, info fs.FileInfo) (string, error) {
+	s.mu.Lock()
+	cached, ok := s.etags[name]
+	s.mu.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.value, nil
+	}
+	file, err := s.fsys.Open(fsName(name))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	value := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	s.mu.Lock()
+	s.etags[name] = etag{modTime: info.ModTime(), size: info.Size(), value: value}
+	s.mu.Unlock()
+	return value, nil
+}
+
+//sniff returns the type of the content of name
+func (s *static) sniff(name string) string {
+	file, err := s.fsys.Open(fsName(name))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer file.Close()
+	var buf [512]byte
+	n, _ := io.ReadFull(file, buf[:])
+	return http.DetectContentType(buf[:n])
+}
+
+//cacheControl returns the Cache-Control of name according to its extension
+func (s *static) cacheControl(name string) string {
+	if cache, ok := s.conf.Cache[path.Ext(name)]; ok {
+		return cache
+	}
+	return s.conf.Cache["*"]
+}
+
+//list writes the entries of the directory name
+func (s *static) list(w http.ResponseWriter, name string) {
+	entries, err := fs.ReadDir(s.fsys, fsName(name))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<pre>\n")
+	for _, entry := range entries {
+		n := entry.Name()
+		if entry.IsDir() {
+			n += "/"
+		}
+		link := url.URL{Path: n}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", link.String(), html.EscapeString(n))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
+
+//fail answers the error of a file which can't be served
+func (s *static) fail(w http.ResponseWriter, err error) {
+	w.Header().Del("Content-Encoding")
+	if os.IsNotExist(err) {
+		http.Error(w, "404 page not found", http.StatusNotFound)
+		return
+	}
+	if os.IsPermission(err) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+//fsName returns the name in an fs.FS of a clean path
+func fsName(name string) string {
+	if name == "/" {
+		return "."
+	}
+	return strings.TrimPrefix(name, "/")
+}
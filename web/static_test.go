@@ -0,0 +1,109 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStatic(t *testing.T) {
+	site := fstest.MapFS{
+		"index.html":       {Data: []byte("<h1>Lunarc</h1>")},
+		"404.html":         {Data: []byte("<h1>Not found</h1>")},
+		"js/app.js":        {Data: []byte("console.log('lunarc')")},
+		"js/app.js.gz":     {Data: []byte("gzipped")},
+		"docs/readme.txt":  {Data: []byte("readme")},
+		"docs/install.txt": {Data: []byte("install")},
+	}
+	h := NewStatic(Static{Fallback: true, Listing: true, NotFound: "404.html", Cache: map[string]string{".js": "max-age=31536000, immutable", "*": "no-cache"}}, site)
+
+	w := serve(h, "GET", "/users/42")
+	if w.Code != http.StatusOK || w.Body.String() != "<h1>Lunarc</h1>" || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("Must fall back to index.html: %v %v %s", w.Code, w.Header(), w.Body.String())
+	}
+	w = serve(h, "GET", "/js/unknown.js")
+	if w.Code != http.StatusNotFound || w.Body.String() != "<h1>Not found</h1>" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Must answer the 404 page: %v %s", w.Code, w.Body.String())
+	}
+
+	w = serve(h, "GET", "/js/app.js")
+	tag := w.Header().Get("ETag")
+	if w.Body.String() != "console.log('lunarc')" || w.Header().Get("Cache-Control") != "max-age=31536000, immutable" || !strings.HasPrefix(tag, `"`) || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Non expected file: %v %s", w.Header(), w.Body.String())
+	}
+	request := httptest.NewRequest("GET", "/js/app.js", nil)
+	request.Header.Set("If-None-Match", tag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, request)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("Must answer 304 to its ETag: %v", w.Code)
+	}
+	w = compressed(h, "/js/app.js", "gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Body.String() != "gzipped" || w.Header().Get("ETag") == tag || !strings.Contains(w.Header().Get("Content-Type"), "javascript") {
+		t.Fatalf("Must serve app.js.gz with its own ETag: %v", w.Header())
+	}
+
+	w = serve(h, "GET", "/docs")
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/docs/" {
+		t.Fatalf("Must redirect to the directory: %v %v", w.Code, w.Header().Get("Location"))
+	}
+	w = serve(h, "GET", "/docs/")
+	if !strings.Contains(w.Body.String(), `<a href="install.txt">install.txt</a>`) {
+		t.Fatalf("Must list the directory: %s", w.Body.String())
+	}
+	h = NewStatic(Static{}, site)
+	if w = serve(h, "GET", "/docs/"); w.Code != http.StatusNotFound {
+		t.Fatalf("Must not list the directory: %v", w.Code)
+	}
+	if w = serve(h, "GET", "/users/42"); w.Code != http.StatusNotFound {
+		t.Fatalf("Must not fall back: %v", w.Code)
+	}
+}
+
+func TestStaticRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lunarc")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>Lunarc</h1>"), 0644); err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+
+	mux := NewLoggingServeMux(Config{})
+	setStatic(mux, Config{Static: Static{Path: "/site", Root: dir, Index: "index.html"}})
+	w := serve(mux.router, "GET", "/site")
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/site/" {
+		t.Fatalf("Must redirect to /site/: %v %v", w.Code, w.Header())
+	}
+	if w = serve(mux.router, "GET", "/site/index.html"); w.Code != http.StatusOK {
+		t.Fatalf("Must serve the files below /site: %v", w.Code)
+	}
+	w = serve(mux.router, "GET", "/site/")
+	if w.Code != http.StatusOK || w.Body.String() != "<h1>Lunarc</h1>" || len(w.Header().Get("Last-Modified")) == 0 {
+		t.Fatalf("Must serve index.html: %v %v %s", w.Code, w.Header(), w.Body.String())
+	}
+	if w = serve(mux.router, "POST", "/site/"); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Must only serve GET and HEAD: %v", w.Code)
+	}
+}
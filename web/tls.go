@@ -0,0 +1,250 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//CertificateInterval is the interval between two checks of the certificate files
+//of a running server
+var CertificateInterval = 30 * time.Second
+
+//tlsVersions are the values of server.ssl.minversion
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+//tlsState is the TLS configuration of a running server
+type tlsState struct {
+	certificates []*tls.Certificate
+	names        map[string]*tls.Certificate
+	clientAuth   tls.ClientAuthType
+	clientCAs    *x509.CertPool
+	minVersion   uint16
+	ciphers      []uint16
+	stamps       string
+}
+
+//secure reports whether the server listens with TLS
+func secure(conf Config) bool {
+	return len(conf.SSL.Certificate) > 0 && len(conf.SSL.Key) > 0 || len(conf.SSL.Certificates) > 0
+}
+
+//MinVersion returns the TLS version of server.ssl.minversion, e.g. 1.2
+func MinVersion(version string) (uint16, error) {
+	if v, ok := tlsVersions[version]; ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %s, must be 1.0, 1.1, 1.2 or 1.3", version)
+}
+
+//CipherSuites returns the ids of cipher suites named like tls.CipherSuiteName, e.g.
+//TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. They only apply up to TLS 1.2.
+func CipherSuites(names []string) (ids []uint16, err error) {
+	suites := make(map[string]uint16)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		suites[suite.Name] = suite.ID
+	}
+	for _, name := range names {
+		id, ok := suites[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return
+}
+
+//ClientAuth returns the policy of the client certificates: none, optional, a
+//certificate is verified when sent, or require. The default is require when
+//client CAs are given, none otherwise.
+func ClientAuth(mode string, ca []string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "":
+		if len(ca) > 0 {
+			return tls.RequireAndVerifyClientCert, nil
+		}
+		return tls.NoClientCert, nil
+	case "none":
+		return tls.NoClientCert, nil
+	case "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("unknown client auth %s, must be none, optional or require", mode)
+}
+
+//loadClientCAs loads the PEM bundles of the CAs of the client certificates
+func loadClientCAs(files []string) (*x509.CertPool, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	for _, file := range files {
+		pem, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", file)
+		}
+	}
+	return pool, nil
+}
+
+//pairs returns the certificate and key files of the configuration, the first one
+//being served to the clients without SNI or with an unknown name
+func pairs(conf Config) (p [][2]string) {
+	if len(conf.SSL.Certificate) > 0 && len(conf.SSL.Key) > 0 {
+		p = append(p, [2]string{conf.SSL.Certificate, conf.SSL.Key})
+	}
+	for _, pair := range conf.SSL.Certificates {
+		p = append(p, [2]string{pair.Certificate, pair.Key})
+	}
+	return
+}
+
+//stamps returns the modification times and sizes of the files of the TLS configuration
+func stamps(conf Config) string {
+	var files []string
+	for _, pair := range pairs(conf) {
+		files = append(files, pair[0], pair[1])
+	}
+	var b strings.Builder
+	for _, file := range append(files, conf.SSL.Client.CA...) {
+		if info, err := os.Stat(file); err == nil {
+			fmt.Fprintf(&b, "%s:%d/%d;", file, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return b.String()
+}
+
+//newTLSState loads the certificates served by the TLS listener, at least one, the
+//CAs verifying the client certificates and the protocol settings
+func newTLSState(conf Config) (state *tlsState, err error) {
+	if len(pairs(conf)) == 0 {
+		return nil, errors.New("no certificate in server.ssl")
+	}
+	state = &tlsState{names: make(map[string]*tls.Certificate), stamps: stamps(conf)}
+	for _, pair := range pairs(conf) {
+		certificate, err := tls.LoadX509KeyPair(pair[0], pair[1])
+		if err != nil {
+			return nil, err
+		}
+		if certificate.Leaf == nil {
+			if certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0]); err != nil {
+				return nil, err
+			}
+		}
+		names := certificate.Leaf.DNSNames
+		if len(names) == 0 && len(certificate.Leaf.Subject.CommonName) > 0 {
+			names = []string{certificate.Leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			if name = strings.ToLower(name); state.names[name] == nil {
+				state.names[name] = &certificate
+			}
+		}
+		state.certificates = append(state.certificates, &certificate)
+	}
+	if state.clientAuth, err = ClientAuth(conf.SSL.Client.Auth, conf.SSL.Client.CA); err != nil {
+		return nil, err
+	}
+	if state.clientCAs, err = loadClientCAs(conf.SSL.Client.CA); err != nil {
+		return nil, err
+	}
+	if len(conf.SSL.MinVersion) > 0 {
+		if state.minVersion, err = MinVersion(conf.SSL.MinVersion); err != nil {
+			return nil, err
+		}
+	}
+	if state.ciphers, err = CipherSuites(conf.SSL.Ciphers); err != nil {
+		return nil, err
+	}
+	return
+}
+
+//certificate returns the certificate of a server name: the one with this name,
+//then with a wildcard matching it, then the first one.
+func (state *tlsState) certificate(name string) *tls.Certificate {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if c, ok := state.names[name]; ok {
+		return c
+	}
+	if i := strings.Index(name, "."); i > 0 {
+		if c, ok := state.names["*"+name[i:]]; ok {
+			return c
+		}
+	}
+	return state.certificates[0]
+}
+
+//loadTLS loads the TLS configuration of the server. On error the current one is kept.
+func (s *Server) loadTLS(conf Config) error {
+	state, err := newTLSState(conf)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.tls = state
+	s.mu.Unlock()
+	return nil
+}
+
+//reloadTLS reloads the TLS configuration when its files changed, or always when force
+func (s *Server) reloadTLS(force bool) {
+	s.mu.RLock()
+	state, conf := s.tls, s.Config
+	s.mu.RUnlock()
+	if state == nil || !force && stamps(conf) == state.stamps {
+		return
+	}
+	if err := s.loadTLS(conf); err != nil {
+		log.Errorf("Can't reload TLS certificate, the current one is kept: %v", err)
+		return
+	}
+	log.Infof("TLS certificate reloaded")
+}
+
+//getConfigForClient returns the TLS configuration of a handshake, with the
+//certificate of its server name
+func (s *Server) getConfigForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	s.mu.RLock()
+	state := s.tls
+	s.mu.RUnlock()
+	return &tls.Config{
+		Certificates: []tls.Certificate{*state.certificate(hello.ServerName)},
+		ClientAuth:   state.clientAuth,
+		ClientCAs:    state.clientCAs,
+		MinVersion:   state.minVersion,
+		CipherSuites: state.ciphers,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}, nil
+}
@@ -0,0 +1,238 @@
+// Copyright (c) - Damien Fontaine <damien.fontaine@lineolia.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package web
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//newCertificate returns a certificate signed by parent, self-signed when nil, and
+//writes it in dir with its key
+func newCertificate(t *testing.T, dir, name string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	signer, signerKey := template, interface{}(key)
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	ioutil.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0600)
+	ioutil.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600)
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	certificate.Leaf, _ = x509.ParseCertificate(der)
+	return certificate
+}
+
+func TestRunMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lunarc")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newCertificate(t, dir, "ca", nil)
+	client := newCertificate(t, dir, "billing", &ca)
+
+	server := getHTTPServer(t, "ssl")
+	server.Config.SSL.Client.CA = []string{filepath.Join(dir, "ca.crt")}
+	server.Handler.(*LoggingServeMux).HandleFunc("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+	})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Run(context.Background())
+	}()
+	waitListening(t)
+
+	get := func(certificates ...tls.Certificate) (string, error) {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, Certificates: certificates}}}
+		resp, err := c.Get("https://localhost:8888/whoami")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		return string(body), err
+	}
+	if _, err := get(); err == nil {
+		t.Fatalf("A client without certificate must be refused")
+	}
+	if _, err := get(newCertificate(t, dir, "intruder", nil)); err == nil {
+		t.Fatalf("A client certificate of another CA must be refused")
+	}
+	if body, err := get(client); err != nil || body != "billing" {
+		t.Fatalf("Non expected answer: %v %v", body, err)
+	}
+	server.Stop()
+	if err := <-errs; err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+}
+
+func TestClientAuthValidation(t *testing.T) {
+	var data = `
+  test:
+    server:
+      port: 8888
+      ssl:
+        client:
+          auth: always`
+	_, err := GetConfig([]byte(data), "test")
+	if err == nil || !strings.Contains(err.Error(), "server.ssl.client.auth") {
+		t.Fatalf("Must report server.ssl.client.auth but %v", err)
+	}
+}
+
+func TestTLSStateSNI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lunarc")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	newCertificate(t, dir, "lunarc.io", nil)
+	newCertificate(t, dir, "api.lunarc.io", nil)
+	newCertificate(t, dir, "*.apps.lunarc.io", nil)
+
+	var conf Config
+	conf.SSL.Certificate, conf.SSL.Key = filepath.Join(dir, "lunarc.io.crt"), filepath.Join(dir, "lunarc.io.key")
+	for _, name := range []string{"api.lunarc.io", "*.apps.lunarc.io"} {
+		conf.SSL.Certificates = append(conf.SSL.Certificates, KeyPair{Certificate: filepath.Join(dir, name+".crt"), Key: filepath.Join(dir, name+".key")})
+	}
+	state, err := newTLSState(conf)
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	for name, expected := range map[string]string{
+		"API.lunarc.io":         "api.lunarc.io",
+		"blog.apps.lunarc.io":   "*.apps.lunarc.io",
+		"a.blog.apps.lunarc.io": "lunarc.io",
+		"unknown.io":            "lunarc.io",
+		"":                      "lunarc.io",
+	} {
+		if cn := state.certificate(name).Leaf.Subject.CommonName; cn != expected {
+			t.Fatalf("%s must get %s but %s", name, expected, cn)
+		}
+	}
+	if _, err := newTLSState(Config{}); err == nil {
+		t.Fatalf("Must refuse a configuration without certificate")
+	}
+}
+
+func TestRunReloadCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lunarc")
+	if err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	interval := CertificateInterval
+	CertificateInterval = 50 * time.Millisecond
+	defer func() { CertificateInterval = interval }()
+
+	first := newCertificate(t, dir, "localhost", nil)
+	server := getHTTPServer(t, "ssl")
+	server.Config.SSL.Certificate, server.Config.SSL.Key = filepath.Join(dir, "localhost.crt"), filepath.Join(dir, "localhost.key")
+	server.Config.SSL.MinVersion = "1.3"
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Run(context.Background())
+	}()
+	waitListening(t)
+
+	served := func(config *tls.Config) (*x509.Certificate, error) {
+		config.InsecureSkipVerify = true
+		conn, err := tls.Dial("tcp", "localhost:8888", config)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0], nil
+	}
+	if c, err := served(&tls.Config{}); err != nil || !c.Equal(first.Leaf) {
+		t.Fatalf("Must serve the first certificate: %v", err)
+	}
+	if _, err := served(&tls.Config{MaxVersion: tls.VersionTLS12}); err == nil {
+		t.Fatalf("TLS 1.2 must be refused")
+	}
+
+	second := newCertificate(t, dir, "localhost", nil)
+	time.Sleep(300 * time.Millisecond)
+	if c, err := served(&tls.Config{}); err != nil || !c.Equal(second.Leaf) {
+		t.Fatalf("Must serve the renewed certificate: %v", err)
+	}
+	removed := server.Config
+	removed.SSL.Certificate, removed.SSL.Key = "", ""
+	server.reload(server.Config, removed)
+	if c, err := served(&tls.Config{}); err != nil || !c.Equal(second.Leaf) {
+		t.Fatalf("Must keep the certificate when server.ssl is removed: %v", err)
+	}
+	server.Stop()
+	if err := <-errs; err != nil {
+		t.Fatalf("Non expected error: %v", err)
+	}
+}
+
+func TestTLSValidation(t *testing.T) {
+	var data = `
+  test:
+    server:
+      port: 8888
+      ssl:
+        minversion: "1.4"
+        ciphers: [TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_UNKNOWN]`
+	_, err := GetConfig([]byte(data), "test")
+	if err == nil || !strings.Contains(err.Error(), "server.ssl.minversion") || !strings.Contains(err.Error(), "TLS_UNKNOWN") {
+		t.Fatalf("Must report server.ssl.minversion and server.ssl.ciphers but %v", err)
+	}
+}